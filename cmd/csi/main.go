@@ -107,6 +107,10 @@ func main() {
 		&driver.MaxRetryCount, "retrycount", 5, "Max retry count to check if volume is ready",
 	)
 
+	cmd.Flags().DurationVar(
+		&driver.StatsTimeout, "statstimeout", driver.StatsTimeout, "Max time to wait for the filesystem statistics of a volume",
+	)
+
 	cmd.PersistentFlags().StringVar(
 		&metricsBindAddress, "metricsBindAddress", "0", "TCP address that the controller should bind to for serving prometheus metrics.",
 	)
@@ -30,6 +30,7 @@ import (
 
 	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
 	"github.com/openebs/jiva-operator/pkg/controllers"
+	jivawebhook "github.com/openebs/jiva-operator/pkg/webhook"
 	"github.com/openebs/jiva-operator/version"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -37,6 +38,7 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -62,15 +64,40 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var maxConcurrentReconciles int
+	var syncPeriod time.Duration
+	var syncingPollInterval time.Duration
+	var readyPollInterval time.Duration
+	var maxUpgradeFailures int
+	var upgradeTimeout time.Duration
+	var maxConcurrentUpgrades int
+	var enableWebhooks bool
+	var webhookCertDir string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8383", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8282", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The number of JivaVolumes that can be reconciled in parallel.")
+	flag.DurationVar(&syncPeriod, "sync-period", 30*time.Second,
+		"The interval at which all the JivaVolumes are reconciled.")
+	flag.DurationVar(&syncingPollInterval, "syncing-poll-interval", 5*time.Second,
+		"The interval at which the status of a JivaVolume is polled while it is Syncing or Unknown.")
+	flag.DurationVar(&readyPollInterval, "ready-poll-interval", 30*time.Second,
+		"The interval at which the status of a JivaVolume is polled while it is Ready.")
+	flag.IntVar(&maxUpgradeFailures, "max-upgrade-failures", 5,
+		"The number of failed attempts after which the upgrade of a JivaVolume is rolled back, 0 disables the rollback.")
+	flag.DurationVar(&upgradeTimeout, "upgrade-timeout", time.Hour,
+		"The time after which an attempt to upgrade a JivaVolume which has not completed is counted as failed, 0 disables it.")
+	flag.IntVar(&maxConcurrentUpgrades, "max-concurrent-upgrades", 1,
+		"The number of JivaVolumes with AutoUpgrade set that are upgraded at once, 0 disables the auto upgrade.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the validating admission webhooks, the serving certificates are read from the webhook-cert-dir.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"The directory with the tls.crt and tls.key of the admission webhook server.")
 	flag.Parse()
 
-	duration := 30 * time.Second
-
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -78,7 +105,8 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "jiva-operator.openebs.io",
-		SyncPeriod:             &duration,
+		SyncPeriod:             &syncPeriod,
+		CertDir:                webhookCertDir,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -89,10 +117,45 @@ func main() {
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
 		Recorder: mgr.GetEventRecorderFor("jivavolume-controller"),
+
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		SyncingPollInterval:     syncingPollInterval,
+		ReadyPollInterval:       readyPollInterval,
+		MaxUpgradeFailures:      maxUpgradeFailures,
+		UpgradeTimeout:          upgradeTimeout,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "JivaVolume")
 		os.Exit(1)
 	}
+	if err = (&controllers.JivaVolumePolicyReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("jivavolumepolicy-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "JivaVolumePolicy")
+		os.Exit(1)
+	}
+	if err = (&controllers.AutoUpgradeReconciler{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("autoupgrade-controller"),
+
+		MaxConcurrentUpgrades: maxConcurrentUpgrades,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "AutoUpgrade")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		hookServer := mgr.GetWebhookServer()
+		hookServer.Register(jivawebhook.JivaVolumePolicyPath, &webhook.Admission{
+			Handler: &jivawebhook.JivaVolumePolicyValidator{Client: mgr.GetClient()},
+		})
+		hookServer.Register(jivawebhook.JivaVolumeValidatePath, &webhook.Admission{
+			Handler: &jivawebhook.JivaVolumeValidator{},
+		})
+		hookServer.Register(jivawebhook.JivaVolumeMutatePath, &webhook.Admission{
+			Handler: &jivawebhook.JivaVolumeDefaulter{},
+		})
+	}
 	// +kubebuilder:scaffold:builder
 	printVersion()
 
@@ -56,6 +56,20 @@ type JivaVolumeSpec struct {
 	// +nullable
 	Policy                   JivaVolumePolicySpec `json:"policy,omitempty"`
 	DesiredReplicationFactor int                  `json:"desiredReplicationFactor,omitempty"`
+	// VolumeSource is the source the data of the volume is cloned
+	// from before the volume becomes ready
+	// +nullable
+	VolumeSource *VolumeSource `json:"volumeSource,omitempty"`
+}
+
+// VolumeSource describes the snapshot of an existing JivaVolume
+// from which the replicas of a new volume are populated
+type VolumeSource struct {
+	// SourceVolume is the name of the JivaVolume the data is cloned from
+	SourceVolume string `json:"sourceVolume"`
+	// Snapshot is the name of the snapshot of the source volume
+	// which is cloned into the new volume
+	Snapshot string `json:"snapshot"`
 }
 
 // JivaVolumeStatus defines the observed state of JivaVolume
@@ -67,6 +81,28 @@ type JivaVolumeStatus struct {
 	ReplicaStatuses []ReplicaStatus `json:"replicaStatus,omitempty"`
 	// Phase represents the current phase of JivaVolume.
 	Phase JivaVolumePhase `json:"phase,omitempty"`
+	// Scaleup records the progress of a replica scaleup which
+	// is carried out one replica at a time
+	// +nullable
+	Scaleup *ScaleupStatus `json:"scaleup,omitempty"`
+	// Conditions are the latest observations of the state of the volume
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ScaleupStatus stores the progress of a replica scaleup
+type ScaleupStatus struct {
+	// InitialReplicationFactor is the replication factor
+	// before the scaleup was started
+	InitialReplicationFactor int `json:"initialReplicationFactor"`
+	// DesiredReplicationFactor is the replication factor
+	// the volume is being scaled up to
+	DesiredReplicationFactor int `json:"desiredReplicationFactor"`
+	// ReplicationFactor is the replication factor of the
+	// step that is currently in progress
+	ReplicationFactor int `json:"replicationFactor"`
 }
 
 // +genclient
@@ -75,6 +111,7 @@ type JivaVolumeStatus struct {
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +k8s:openapi-gen=true
 // +kubebuilder:resource:scope=Namespaced,shortName=jv
+// +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="ReplicaCount",type="string",JSONPath=`.status.replicaCount`
 // +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=`.status.phase`
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=`.status.status`
@@ -100,6 +137,25 @@ type JivaVolumeList struct {
 type ReplicaStatus struct {
 	Address string `json:"address,omitempty"`
 	Mode    string `json:"mode,omitempty"`
+	// PodName is the name of the replica pod
+	PodName string `json:"podName,omitempty"`
+	// NodeName is the name of the node the replica pod is scheduled on
+	NodeName string `json:"nodeName,omitempty"`
+	// PVC is the name of the claim holding the data of the replica
+	PVC string `json:"pvc,omitempty"`
+	// RevisionCounter is the no of IOs done on the replica
+	RevisionCounter int64 `json:"revisionCounter,omitempty"`
+	// RebuildProgress is the percentage of the data synced to
+	// the replica while it is being rebuilt
+	RebuildProgress int `json:"rebuildProgress,omitempty"`
+	// LastSeenTime is the last time the replica was
+	// found connected to the controller
+	// +nullable
+	LastSeenTime *metav1.Time `json:"lastSeenTime,omitempty"`
+	// DetailsUpdateTime is the last time the pod, revision
+	// counter and rebuild progress of the replica were refreshed
+	// +nullable
+	DetailsUpdateTime *metav1.Time `json:"detailsUpdateTime,omitempty"`
 }
 
 // JivaVolumePhase represents the current phase of JivaVolume.
@@ -130,6 +186,33 @@ const (
 	JivaVolumePhaseDeleting JivaVolumePhase = "Deleting"
 )
 
+// Condition types of JivaVolume
+const (
+	// JivaVolumeConditionTargetReady indicates that the jiva
+	// controller is serving IOs in RW mode
+	JivaVolumeConditionTargetReady = "TargetReady"
+
+	// JivaVolumeConditionReplicasHealthy indicates that all the
+	// replicas of the volume are connected in RW mode
+	JivaVolumeConditionReplicasHealthy = "ReplicasHealthy"
+
+	// JivaVolumeConditionQuorumAvailable indicates that qurom
+	// number of replicas of the volume are in RW mode
+	JivaVolumeConditionQuorumAvailable = "QuorumAvailable"
+
+	// JivaVolumeConditionScalingInProgress indicates that the replicas
+	// are being scaled to the desired replication factor
+	JivaVolumeConditionScalingInProgress = "ScalingInProgress"
+
+	// JivaVolumeConditionUpgradeInProgress indicates that the volume
+	// is being upgraded to the desired version
+	JivaVolumeConditionUpgradeInProgress = "UpgradeInProgress"
+
+	// JivaVolumeConditionResizeInProgress indicates that the size of
+	// the volume served by the controller is less than the capacity
+	JivaVolumeConditionResizeInProgress = "ResizeInProgress"
+)
+
 func init() {
 	SchemeBuilder.Register(&JivaVolume{}, &JivaVolumeList{})
 }
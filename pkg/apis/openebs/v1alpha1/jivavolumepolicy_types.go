@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -40,6 +42,21 @@ type JivaVolumePolicySpec struct {
 	// ReplicaSpec represents configuration related to replicas resources
 	// +nullable
 	Replica ReplicaSpec `json:"replica,omitempty"`
+	// StatusPoll configures the intervals at which the status of
+	// the volume is polled from the jiva controller
+	// +nullable
+	StatusPoll *StatusPollSpec `json:"statusPoll,omitempty"`
+}
+
+// StatusPollSpec represents the intervals at which the status of the
+// volume is polled, the intervals of the operator are used if not set
+type StatusPollSpec struct {
+	// SyncingInterval is the interval at which the status is
+	// polled while the volume is Syncing or its status is Unknown
+	SyncingInterval *metav1.Duration `json:"syncingInterval,omitempty"`
+	// ReadyInterval is the interval at which the status is
+	// polled while the volume is Ready
+	ReadyInterval *metav1.Duration `json:"readyInterval,omitempty"`
 }
 
 // TargetSpec represents configuration related to jiva target deployment
@@ -59,6 +76,37 @@ type TargetSpec struct {
 	AuxResources *corev1.ResourceRequirements `json:"auxResources,omitempty"`
 }
 
+// ReplicaAntiAffinityKey is the label set on the replicas with the value
+// required by the pod anti-affinity of the replicas in the policy
+const ReplicaAntiAffinityKey = "openebs.io/replica-anti-affinity"
+
+// ReplicaAntiAffinityValue returns the value of the replica anti-affinity
+// label required by the selector, false is returned if the selector doesn't
+// require the label. The other requirements of the selector are not
+// checked, as only the anti-affinity label is set on the replicas. An
+// error is returned if the label is required in a way which can't be set
+// as the label of the replicas, i.e. other than a single value.
+func ReplicaAntiAffinityValue(selector *metav1.LabelSelector) (string, bool, error) {
+	if selector == nil {
+		return "", false, nil
+	}
+	value, ok := selector.MatchLabels[ReplicaAntiAffinityKey]
+	for _, expr := range selector.MatchExpressions {
+		if expr.Key != ReplicaAntiAffinityKey {
+			continue
+		}
+		if expr.Operator != metav1.LabelSelectorOpIn || len(expr.Values) != 1 {
+			return "", false, fmt.Errorf("%s must be required with a single value", ReplicaAntiAffinityKey)
+		}
+		if ok && expr.Values[0] != value {
+			return "", false, fmt.Errorf("%s is required with both %s and %s",
+				ReplicaAntiAffinityKey, value, expr.Values[0])
+		}
+		value, ok = expr.Values[0], true
+	}
+	return value, ok, nil
+}
+
 // ReplicaSpec represents configuration related to jiva replica sts
 type ReplicaSpec struct {
 	// PodTemplateResources represents the configuration for replica sts.
@@ -85,15 +133,28 @@ type PodTemplateResources struct {
 
 // JivaVolumePolicyStatus is for handling status of JivaVolumePolicy
 type JivaVolumePolicyStatus struct {
+	// Phase indicates if the policy is Valid or Invalid
 	Phase string `json:"phase"`
+	// Message describes why the policy is Invalid
+	Message string `json:"message,omitempty"`
 }
 
+const (
+	// JivaVolumePolicyPhaseValid is the phase of a policy
+	// which can be used to provision volumes
+	JivaVolumePolicyPhaseValid = "Valid"
+	// JivaVolumePolicyPhaseInvalid is the phase of a policy
+	// which failed validation, it is not propagated to the volumes
+	JivaVolumePolicyPhaseInvalid = "Invalid"
+)
+
 // +genclient
 // JivaVolumePolicy is the Schema for the jivavolumes API
 // Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +k8s:openapi-gen=true
 // +kubebuilder:resource:scope=Namespaced,shortName=jvp
+// +kubebuilder:subresource:status
 type JivaVolumePolicy struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -22,6 +22,7 @@ package v1alpha1
 
 import (
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -169,6 +170,11 @@ func (in *JivaVolumePolicySpec) DeepCopyInto(out *JivaVolumePolicySpec) {
 	*out = *in
 	in.Target.DeepCopyInto(&out.Target)
 	in.Replica.DeepCopyInto(&out.Replica)
+	if in.StatusPoll != nil {
+		in, out := &in.StatusPoll, &out.StatusPoll
+		*out = new(StatusPollSpec)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -204,6 +210,11 @@ func (in *JivaVolumeSpec) DeepCopyInto(out *JivaVolumeSpec) {
 	out.ISCSISpec = in.ISCSISpec
 	out.MountInfo = in.MountInfo
 	in.Policy.DeepCopyInto(&out.Policy)
+	if in.VolumeSource != nil {
+		in, out := &in.VolumeSource, &out.VolumeSource
+		*out = new(VolumeSource)
+		**out = **in
+	}
 	return
 }
 
@@ -223,7 +234,21 @@ func (in *JivaVolumeStatus) DeepCopyInto(out *JivaVolumeStatus) {
 	if in.ReplicaStatuses != nil {
 		in, out := &in.ReplicaStatuses, &out.ReplicaStatuses
 		*out = make([]ReplicaStatus, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Scaleup != nil {
+		in, out := &in.Scaleup, &out.Scaleup
+		*out = new(ScaleupStatus)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
@@ -314,6 +339,14 @@ func (in *ReplicaSpec) DeepCopy() *ReplicaSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReplicaStatus) DeepCopyInto(out *ReplicaStatus) {
 	*out = *in
+	if in.LastSeenTime != nil {
+		in, out := &in.LastSeenTime, &out.LastSeenTime
+		*out = (*in).DeepCopy()
+	}
+	if in.DetailsUpdateTime != nil {
+		in, out := &in.DetailsUpdateTime, &out.DetailsUpdateTime
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -327,6 +360,48 @@ func (in *ReplicaStatus) DeepCopy() *ReplicaStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleupStatus) DeepCopyInto(out *ScaleupStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleupStatus.
+func (in *ScaleupStatus) DeepCopy() *ScaleupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StatusPollSpec) DeepCopyInto(out *StatusPollSpec) {
+	*out = *in
+	if in.SyncingInterval != nil {
+		in, out := &in.SyncingInterval, &out.SyncingInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ReadyInterval != nil {
+		in, out := &in.ReadyInterval, &out.ReadyInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatusPollSpec.
+func (in *StatusPollSpec) DeepCopy() *StatusPollSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StatusPollSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TargetSpec) DeepCopyInto(out *TargetSpec) {
 	*out = *in
@@ -382,3 +457,19 @@ func (in *VersionStatus) DeepCopy() *VersionStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeSource) DeepCopyInto(out *VolumeSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeSource.
+func (in *VolumeSource) DeepCopy() *VolumeSource {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeSource)
+	in.DeepCopyInto(out)
+	return out
+}
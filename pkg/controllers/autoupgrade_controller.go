@@ -0,0 +1,182 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openebs/jiva-operator/version"
+	operr "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+const (
+	// autoUpgradeRequeueInterval is the interval after which a volume waiting
+	// for the other volumes to finish their upgrade is reconciled again
+	autoUpgradeRequeueInterval = 30 * time.Second
+	// autoUpgradeReservationTTL is the time for which a volume whose
+	// desired version was set is counted as upgrading, while the cache
+	// may not yet have seen the change
+	autoUpgradeReservationTTL = time.Minute
+)
+
+// AutoUpgradeReconciler upgrades the JivaVolumes with AutoUpgrade set to
+// the version of the operator, by setting their desired version. The
+// JivaVolume controller then upgrades the components of the volume.
+type AutoUpgradeReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	// MaxConcurrentUpgrades is the number of volumes which are
+	// upgraded at once, 0 disables the auto upgrade
+	MaxConcurrentUpgrades int
+
+	// reserved holds the time at which the desired version of the
+	// volumes was set, so that they are counted as upgrading even
+	// if the cache is yet to see the change
+	mu       sync.Mutex
+	reserved map[types.NamespacedName]time.Time
+}
+
+// +kubebuilder:rbac:groups=openebs.io.openebs.io,resources=jivavolumes,verbs=get;list;watch;patch
+
+// Reconcile sets the desired version of the JivaVolume to the version of
+// the operator if fewer than MaxConcurrentUpgrades volumes are upgrading
+// and none of the upgraded volumes has failed its upgrade
+func (r *AutoUpgradeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if r.MaxConcurrentUpgrades <= 0 {
+		return reconcile.Result{}, nil
+	}
+	cr := &openebsiov1alpha1.JivaVolume{}
+	err := r.Get(context.TODO(), req.NamespacedName, cr)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if !needsAutoUpgrade(cr) {
+		return reconcile.Result{}, nil
+	}
+
+	// the volumes are counted and reserved under the lock, so
+	// that the parallel reconciles don't exceed the limit
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	volumes := openebsiov1alpha1.JivaVolumeList{}
+	if err := r.List(context.TODO(), &volumes); err != nil {
+		return reconcile.Result{}, operr.Wrap(err, "failed to list volumes")
+	}
+	upgrading := 0
+	for i := range volumes.Items {
+		jv := &volumes.Items[i]
+		// the upgrades are stopped till the failed volume is either
+		// upgraded or rolled back and upgraded again by the user
+		if upgradeFailures(jv) > 0 || isRolledBack(jv) {
+			logrus.Infof("not upgrading volume %s, upgrade of volume %s has failed", cr.Name, jv.Name)
+			return reconcile.Result{RequeueAfter: autoUpgradeRequeueInterval}, nil
+		}
+		if jv.VersionDetails.Desired != jv.VersionDetails.Status.Current ||
+			r.isReserved(types.NamespacedName{Name: jv.Name, Namespace: jv.Namespace}) {
+			upgrading++
+		}
+	}
+	if upgrading >= r.MaxConcurrentUpgrades {
+		logrus.Infof("not upgrading volume %s, %d volumes are being upgraded", cr.Name, upgrading)
+		return reconcile.Result{RequeueAfter: autoUpgradeRequeueInterval}, nil
+	}
+
+	from := cr.VersionDetails.Status.Current
+	newCR := cr.DeepCopy()
+	newCR.VersionDetails.Desired = version.Version
+	err = r.Patch(context.TODO(), newCR,
+		client.MergeFromWithOptions(cr, client.MergeFromWithOptimisticLock{}))
+	if err != nil {
+		return reconcile.Result{}, operr.Wrapf(err, "failed to set desired version of volume %s", cr.Name)
+	}
+	if r.reserved == nil {
+		r.reserved = map[types.NamespacedName]time.Time{}
+	}
+	r.reserved[req.NamespacedName] = time.Now()
+	logrus.Infof("auto upgrading volume %s from %s to %s", cr.Name, from, version.Version)
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, "AutoUpgrade",
+		"upgrading from %s to %s", from, version.Version)
+	return reconcile.Result{}, nil
+}
+
+// isReserved returns true if the desired version of the volume was set
+// within autoUpgradeReservationTTL, the expired reservations are removed
+func (r *AutoUpgradeReconciler) isReserved(key types.NamespacedName) bool {
+	at, ok := r.reserved[key]
+	if !ok {
+		return false
+	}
+	if time.Since(at) > autoUpgradeReservationTTL {
+		delete(r.reserved, key)
+		return false
+	}
+	return true
+}
+
+// needsAutoUpgrade returns true if the volume has opted in for the auto
+// upgrade, is bootstrapped and is on an older version which can be
+// upgraded. The volumes which are Syncing or Unknown are upgraded as
+// well, as the upgrade of the operator may have restarted their target.
+func needsAutoUpgrade(cr *openebsiov1alpha1.JivaVolume) bool {
+	vd := cr.VersionDetails
+	return vd.AutoUpgrade &&
+		cr.DeletionTimestamp == nil &&
+		isBootstrapped(cr) &&
+		vd.Status.Current != version.Version &&
+		vd.Desired == vd.Status.Current &&
+		!isRolledBack(cr) &&
+		version.IsCurrentVersionValid(vd.Status.Current)
+}
+
+func isBootstrapped(cr *openebsiov1alpha1.JivaVolume) bool {
+	switch cr.Status.Phase {
+	case openebsiov1alpha1.JivaVolumePhaseReady,
+		openebsiov1alpha1.JivaVolumePhaseSyncing,
+		openebsiov1alpha1.JivaVolumePhaseUnkown:
+		return true
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *AutoUpgradeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	autoUpgrade := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		cr, ok := obj.(*openebsiov1alpha1.JivaVolume)
+		return ok && cr.VersionDetails.AutoUpgrade
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("autoupgrade").
+		For(&openebsiov1alpha1.JivaVolume{}, builder.WithPredicates(autoUpgrade)).
+		Complete(r)
+}
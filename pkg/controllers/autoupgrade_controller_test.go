@@ -0,0 +1,198 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openebs/jiva-operator/version"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+// oldJivaVolume returns a Ready volume of the ci version,
+// which can be upgraded to the version of the test binary
+func oldJivaVolume(name string, autoUpgrade bool) *openebsiov1alpha1.JivaVolume {
+	cr := &openebsiov1alpha1.JivaVolume{}
+	cr.Name = name
+	cr.Namespace = "openebs"
+	cr.Status.Phase = openebsiov1alpha1.JivaVolumePhaseReady
+	cr.VersionDetails.AutoUpgrade = autoUpgrade
+	cr.VersionDetails.Desired = "master"
+	cr.VersionDetails.Status.Current = "master"
+	return cr
+}
+
+func TestAutoUpgradeReconcile(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := openebsiov1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	upgrading := oldJivaVolume("pvc-2", true)
+	upgrading.VersionDetails.Desired = version.Version
+	failed := oldJivaVolume("pvc-2", false)
+	failed.Annotations = map[string]string{upgradeFailuresAnnotation: "1"}
+	rolledBack := oldJivaVolume("pvc-2", false)
+	rolledBack.Annotations = map[string]string{upgradeRolledBackAnnotation: version.Version}
+	syncing := oldJivaVolume("pvc-1", true)
+	syncing.Status.Phase = openebsiov1alpha1.JivaVolumePhaseSyncing
+	pending := oldJivaVolume("pvc-1", true)
+	pending.Status.Phase = openebsiov1alpha1.JivaVolumePhasePending
+
+	tests := map[string]struct {
+		volume       *openebsiov1alpha1.JivaVolume
+		others       []client.Object
+		maxUpgrades  int
+		wantUpgraded bool
+		wantRequeued bool
+	}{
+		"volume is upgraded": {
+			volume:       oldJivaVolume("pvc-1", true),
+			others:       []client.Object{oldJivaVolume("pvc-2", true)},
+			maxUpgrades:  1,
+			wantUpgraded: true,
+		},
+		"volume without auto upgrade is left as is": {
+			volume:      oldJivaVolume("pvc-1", false),
+			maxUpgrades: 1,
+		},
+		"syncing volume is upgraded": {
+			volume:       syncing,
+			maxUpgrades:  1,
+			wantUpgraded: true,
+		},
+		"volume which is not bootstrapped is left as is": {
+			volume:      pending,
+			maxUpgrades: 1,
+		},
+		"auto upgrade is disabled": {
+			volume: oldJivaVolume("pvc-1", true),
+		},
+		"volume waits for the upgrading volumes": {
+			volume:       oldJivaVolume("pvc-1", true),
+			others:       []client.Object{upgrading},
+			maxUpgrades:  1,
+			wantRequeued: true,
+		},
+		"volume is upgraded alongside the upgrading volumes": {
+			volume:       oldJivaVolume("pvc-1", true),
+			others:       []client.Object{upgrading},
+			maxUpgrades:  2,
+			wantUpgraded: true,
+		},
+		"upgrades are stopped on a failed upgrade": {
+			volume:       oldJivaVolume("pvc-1", true),
+			others:       []client.Object{failed},
+			maxUpgrades:  2,
+			wantRequeued: true,
+		},
+		"upgrades are stopped on a rolled back upgrade": {
+			volume:       oldJivaVolume("pvc-1", true),
+			others:       []client.Object{rolledBack},
+			maxUpgrades:  2,
+			wantRequeued: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(s).
+				WithObjects(append(tt.others, tt.volume.DeepCopy())...).Build()
+			r := &AutoUpgradeReconciler{
+				Client:                c,
+				Recorder:              record.NewFakeRecorder(10),
+				MaxConcurrentUpgrades: tt.maxUpgrades,
+			}
+			key := types.NamespacedName{Name: tt.volume.Name, Namespace: tt.volume.Namespace}
+			result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if requeued := result.RequeueAfter > 0; requeued != tt.wantRequeued {
+				t.Errorf("Reconcile() = %+v, want requeued %v", result, tt.wantRequeued)
+			}
+			got := &openebsiov1alpha1.JivaVolume{}
+			if err := c.Get(context.TODO(), key, got); err != nil {
+				t.Fatal(err)
+			}
+			if upgraded := got.VersionDetails.Desired == version.Version; upgraded != tt.wantUpgraded {
+				t.Errorf("desired version = %s, want upgraded %v", got.VersionDetails.Desired, tt.wantUpgraded)
+			}
+		})
+	}
+}
+
+func TestAutoUpgradeReservation(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := openebsiov1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// the upgraded volume is still seen with its old desired
+	// version, as the cache is yet to see the change
+	stale := oldJivaVolume("pvc-2", true)
+	c := fake.NewClientBuilder().WithScheme(s).
+		WithObjects(oldJivaVolume("pvc-1", true), stale).Build()
+	r := &AutoUpgradeReconciler{
+		Client:                c,
+		Recorder:              record.NewFakeRecorder(10),
+		MaxConcurrentUpgrades: 1,
+		reserved: map[types.NamespacedName]time.Time{
+			{Name: "pvc-2", Namespace: "openebs"}: time.Now(),
+		},
+	}
+	key := types.NamespacedName{Name: "pvc-1", Namespace: "openebs"}
+	result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Errorf("Reconcile() = %+v, want the volume to wait for the reserved volume", result)
+	}
+
+	r.reserved[types.NamespacedName{Name: "pvc-2", Namespace: "openebs"}] =
+		time.Now().Add(-autoUpgradeReservationTTL - time.Second)
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	got := &openebsiov1alpha1.JivaVolume{}
+	if err := c.Get(context.TODO(), key, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.VersionDetails.Desired != version.Version {
+		t.Errorf("desired version = %s, want the volume upgraded once the reservation expired",
+			got.VersionDetails.Desired)
+	}
+	if _, ok := r.reserved[key]; !ok {
+		t.Errorf("upgraded volume %s is not reserved", key)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/openebs/jiva-operator/pkg/volume"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+// setCondition adds or updates the condition of the given type, the
+// transition time is changed only if the status of the condition changes
+func setCondition(cr *openebsiov1alpha1.JivaVolume, condType string,
+	status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+		Type:               condType,
+		Status:             status,
+		ObservedGeneration: cr.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setVolumeConditions updates the conditions derived from the stats
+// of the jiva controller, statsErr is the error in fetching the stats
+func setVolumeConditions(cr *openebsiov1alpha1.JivaVolume, stats *volume.Stats, statsErr error) {
+	if statsErr != nil {
+		msg := fmt.Sprintf("failed to get volume stats: %v", statsErr)
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionTargetReady,
+			metav1.ConditionUnknown, "TargetUnreachable", msg)
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionReplicasHealthy,
+			metav1.ConditionUnknown, "TargetUnreachable", msg)
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionQuorumAvailable,
+			metav1.ConditionUnknown, "TargetUnreachable", msg)
+		return
+	}
+
+	switch stats.TargetStatus {
+	case "RW":
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionTargetReady,
+			metav1.ConditionTrue, "TargetRW", "target is serving IOs in RW mode")
+	case "RO":
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionTargetReady,
+			metav1.ConditionFalse, "TargetRO", "target is in RO mode")
+	default:
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionTargetReady,
+			metav1.ConditionFalse, "TargetNotReady",
+			fmt.Sprintf("target status is {%s}", stats.TargetStatus))
+	}
+
+	rf := cr.Spec.Policy.Target.ReplicationFactor
+	rw := 0
+	for _, rep := range stats.Replicas {
+		if rep.Mode == "RW" {
+			rw++
+		}
+	}
+
+	if rw == rf && len(stats.Replicas) == rf {
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionReplicasHealthy,
+			metav1.ConditionTrue, "AllReplicasRW",
+			fmt.Sprintf("%d of %d replicas are in RW mode", rw, rf))
+	} else {
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionReplicasHealthy,
+			metav1.ConditionFalse, "ReplicasDegraded",
+			fmt.Sprintf("%d of %d replicas are in RW mode", rw, rf))
+	}
+
+	qurom := (rf / 2) + 1
+	if rw >= qurom {
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionQuorumAvailable,
+			metav1.ConditionTrue, "QuorumReplicasRW",
+			fmt.Sprintf("%d replicas are in RW mode, qurom is %d", rw, qurom))
+	} else {
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionQuorumAvailable,
+			metav1.ConditionFalse, "QuorumLost",
+			fmt.Sprintf("%d replicas are in RW mode, qurom is %d", rw, qurom))
+	}
+
+	setResizeCondition(cr, stats)
+	setScalingCondition(cr, rw == rf && len(stats.Replicas) == rf)
+}
+
+// setResizeCondition compares the size of the volume served by the
+// controller against the capacity requested in the spec
+func setResizeCondition(cr *openebsiov1alpha1.JivaVolume, stats *volume.Stats) {
+	capacity, err := resource.ParseQuantity(cr.Spec.Capacity)
+	if err != nil {
+		return
+	}
+	size, err := stats.Size.Int64()
+	if err != nil {
+		return
+	}
+	if size < capacity.Value() {
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionResizeInProgress,
+			metav1.ConditionTrue, "Resizing",
+			fmt.Sprintf("volume size %d is less than capacity %s", size, cr.Spec.Capacity))
+		return
+	}
+	setCondition(cr, openebsiov1alpha1.JivaVolumeConditionResizeInProgress,
+		metav1.ConditionFalse, "ResizeComplete",
+		fmt.Sprintf("volume size matches capacity %s", cr.Spec.Capacity))
+}
+
+// setScalingCondition marks the scaling as in progress till the replication
+// factor reaches the desired replication factor and the replicas are healthy
+func setScalingCondition(cr *openebsiov1alpha1.JivaVolume, healthy bool) {
+	rf := cr.Spec.Policy.Target.ReplicationFactor
+	desired := cr.Spec.DesiredReplicationFactor
+	switch {
+	case desired > rf:
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionScalingInProgress,
+			metav1.ConditionTrue, "ScalingUp",
+			fmt.Sprintf("scaling up replicas from %d to %d", rf, desired))
+	case desired > 0 && desired < rf:
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionScalingInProgress,
+			metav1.ConditionTrue, "ScalingDown",
+			fmt.Sprintf("scaling down replicas from %d to %d", rf, desired))
+	case isScaledownRejected(cr):
+		// keep the refusal till the desired
+		// replication factor is changed again
+	case !healthy && meta.IsStatusConditionTrue(cr.Status.Conditions,
+		openebsiov1alpha1.JivaVolumeConditionScalingInProgress):
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionScalingInProgress,
+			metav1.ConditionTrue, "WaitingForReplicas",
+			fmt.Sprintf("waiting for %d replicas to be in RW mode", rf))
+	default:
+		setCondition(cr, openebsiov1alpha1.JivaVolumeConditionScalingInProgress,
+			metav1.ConditionFalse, "ScalingComplete",
+			fmt.Sprintf("replication factor is %d", rf))
+	}
+}
+
+// isScaledownRejected returns true if the last scaledown of
+// the volume was rejected by the reconciler
+func isScaledownRejected(cr *openebsiov1alpha1.JivaVolume) bool {
+	cond := meta.FindStatusCondition(cr.Status.Conditions,
+		openebsiov1alpha1.JivaVolumeConditionScalingInProgress)
+	return cond != nil && cond.Reason == scaledownRejectedReason
+}
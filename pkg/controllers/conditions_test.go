@@ -0,0 +1,114 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/openebs/jiva-operator/pkg/volume"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+func TestSetVolumeConditions(t *testing.T) {
+	tests := []struct {
+		name     string
+		desired  int
+		stats    *volume.Stats
+		statsErr error
+		want     map[string]metav1.ConditionStatus
+	}{
+		{
+			name:    "healthy volume",
+			desired: 3,
+			stats: &volume.Stats{
+				TargetStatus: "RW",
+				Size:         "1073741824",
+				Replicas:     []volume.Replica{{Mode: "RW"}, {Mode: "RW"}, {Mode: "RW"}},
+			},
+			want: map[string]metav1.ConditionStatus{
+				openebsiov1alpha1.JivaVolumeConditionTargetReady:       metav1.ConditionTrue,
+				openebsiov1alpha1.JivaVolumeConditionReplicasHealthy:   metav1.ConditionTrue,
+				openebsiov1alpha1.JivaVolumeConditionQuorumAvailable:   metav1.ConditionTrue,
+				openebsiov1alpha1.JivaVolumeConditionResizeInProgress:  metav1.ConditionFalse,
+				openebsiov1alpha1.JivaVolumeConditionScalingInProgress: metav1.ConditionFalse,
+			},
+		},
+		{
+			name:    "degraded volume with qurom",
+			desired: 3,
+			stats: &volume.Stats{
+				TargetStatus: "RW",
+				Size:         "1073741824",
+				Replicas:     []volume.Replica{{Mode: "RW"}, {Mode: "RW"}, {Mode: "WO"}},
+			},
+			want: map[string]metav1.ConditionStatus{
+				openebsiov1alpha1.JivaVolumeConditionTargetReady:     metav1.ConditionTrue,
+				openebsiov1alpha1.JivaVolumeConditionReplicasHealthy: metav1.ConditionFalse,
+				openebsiov1alpha1.JivaVolumeConditionQuorumAvailable: metav1.ConditionTrue,
+			},
+		},
+		{
+			name:    "lost qurom while resizing and scaling up",
+			desired: 4,
+			stats: &volume.Stats{
+				TargetStatus: "RO",
+				Size:         "536870912",
+				Replicas:     []volume.Replica{{Mode: "RW"}},
+			},
+			want: map[string]metav1.ConditionStatus{
+				openebsiov1alpha1.JivaVolumeConditionTargetReady:       metav1.ConditionFalse,
+				openebsiov1alpha1.JivaVolumeConditionQuorumAvailable:   metav1.ConditionFalse,
+				openebsiov1alpha1.JivaVolumeConditionResizeInProgress:  metav1.ConditionTrue,
+				openebsiov1alpha1.JivaVolumeConditionScalingInProgress: metav1.ConditionTrue,
+			},
+		},
+		{
+			name:     "unreachable target",
+			desired:  3,
+			stats:    &volume.Stats{},
+			statsErr: fmt.Errorf("connection refused"),
+			want: map[string]metav1.ConditionStatus{
+				openebsiov1alpha1.JivaVolumeConditionTargetReady:     metav1.ConditionUnknown,
+				openebsiov1alpha1.JivaVolumeConditionReplicasHealthy: metav1.ConditionUnknown,
+				openebsiov1alpha1.JivaVolumeConditionQuorumAvailable: metav1.ConditionUnknown,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &openebsiov1alpha1.JivaVolume{}
+			cr.Spec.Capacity = "1Gi"
+			cr.Spec.DesiredReplicationFactor = tt.desired
+			cr.Spec.Policy.Target.ReplicationFactor = 3
+			setVolumeConditions(cr, tt.stats, tt.statsErr)
+			for condType, want := range tt.want {
+				cond := meta.FindStatusCondition(cr.Status.Conditions, condType)
+				if cond == nil {
+					t.Errorf("condition %s not set", condType)
+					continue
+				}
+				if cond.Status != want {
+					t.Errorf("condition %s = %v, want %v", condType, cond.Status, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// targetEndpoint is the running jiva controller pod of a volume
+type targetEndpoint struct {
+	pod string
+	ip  string
+}
+
+// targetEndpoints caches the IP of the running jiva controller pod of
+// each volume keyed by the namespaced name of the JivaVolume. It is kept
+// up to date by the events of the pod informer, so that an entry is
+// replaced when the controller pod restarts and dropped when it is gone.
+// It is safe to use from concurrent reconciles.
+type targetEndpoints struct {
+	sync.RWMutex
+	endpoints map[types.NamespacedName]targetEndpoint
+}
+
+var _ toolscache.ResourceEventHandler = &targetEndpoints{}
+
+func newTargetEndpoints() *targetEndpoints {
+	return &targetEndpoints{
+		endpoints: map[types.NamespacedName]targetEndpoint{},
+	}
+}
+
+// get returns the IP of the controller pod of the volume
+func (t *targetEndpoints) get(key types.NamespacedName) (string, bool) {
+	t.RLock()
+	defer t.RUnlock()
+	ep, ok := t.endpoints[key]
+	return ep.ip, ok
+}
+
+func (t *targetEndpoints) set(key types.NamespacedName, pod, ip string) {
+	t.Lock()
+	defer t.Unlock()
+	t.endpoints[key] = targetEndpoint{pod: pod, ip: ip}
+}
+
+// invalidate drops the entry of the volume
+func (t *targetEndpoints) invalidate(key types.NamespacedName) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.endpoints, key)
+}
+
+// invalidatePod drops the entry of the volume only if it belongs to the
+// given pod, so that events of an old pod don't drop the entry of the
+// pod which replaced it
+func (t *targetEndpoints) invalidatePod(key types.NamespacedName, pod string) {
+	t.Lock()
+	defer t.Unlock()
+	if ep, ok := t.endpoints[key]; ok && ep.pod == pod {
+		delete(t.endpoints, key)
+	}
+}
+
+// OnAdd implements toolscache.ResourceEventHandler
+func (t *targetEndpoints) OnAdd(obj interface{}) {
+	if pod, ok := obj.(*corev1.Pod); ok {
+		t.syncPod(pod)
+	}
+}
+
+// OnUpdate implements toolscache.ResourceEventHandler
+func (t *targetEndpoints) OnUpdate(oldObj, newObj interface{}) {
+	if pod, ok := newObj.(*corev1.Pod); ok {
+		t.syncPod(pod)
+	}
+}
+
+// OnDelete implements toolscache.ResourceEventHandler
+func (t *targetEndpoints) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	if key, ok := targetEndpointKey(pod); ok {
+		t.invalidatePod(key, pod.Name)
+	}
+}
+
+func (t *targetEndpoints) syncPod(pod *corev1.Pod) {
+	key, ok := targetEndpointKey(pod)
+	if !ok {
+		return
+	}
+	if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" ||
+		pod.DeletionTimestamp != nil {
+		t.invalidatePod(key, pod.Name)
+		return
+	}
+	t.set(key, pod.Name, pod.Status.PodIP)
+}
+
+// targetEndpointKey returns the namespaced name of the JivaVolume
+// served by the pod, if the pod is a jiva controller pod
+func targetEndpointKey(pod *corev1.Pod) (types.NamespacedName, bool) {
+	if pod.Labels["openebs.io/component"] != "jiva-controller" {
+		return types.NamespacedName{}, false
+	}
+	name := pod.Labels["openebs.io/persistent-volume"]
+	if name == "" {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Name: name, Namespace: pod.Namespace}, true
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+func controllerPod(name, ip string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "openebs",
+			Labels: map[string]string{
+				"openebs.io/component":         "jiva-controller",
+				"openebs.io/persistent-volume": "pvc-1",
+			},
+		},
+		Status: corev1.PodStatus{Phase: phase, PodIP: ip},
+	}
+}
+
+func TestTargetEndpoints(t *testing.T) {
+	key := types.NamespacedName{Name: "pvc-1", Namespace: "openebs"}
+	eps := newTargetEndpoints()
+
+	eps.OnAdd(controllerPod("ctrl-a", "", corev1.PodPending))
+	if _, ok := eps.get(key); ok {
+		t.Fatalf("pending pod must not be cached")
+	}
+
+	eps.OnUpdate(nil, controllerPod("ctrl-a", "10.0.0.1", corev1.PodRunning))
+	if ip, _ := eps.get(key); ip != "10.0.0.1" {
+		t.Fatalf("get() = %q, want %q", ip, "10.0.0.1")
+	}
+
+	// the restarted pod replaces the entry and the deletion
+	// of the old pod must not drop it
+	eps.OnAdd(controllerPod("ctrl-b", "10.0.0.2", corev1.PodRunning))
+	eps.OnDelete(toolscache.DeletedFinalStateUnknown{Obj: controllerPod("ctrl-a", "10.0.0.1", corev1.PodRunning)})
+	if ip, _ := eps.get(key); ip != "10.0.0.2" {
+		t.Fatalf("get() = %q, want %q", ip, "10.0.0.2")
+	}
+
+	eps.OnDelete(controllerPod("ctrl-b", "10.0.0.2", corev1.PodRunning))
+	if _, ok := eps.get(key); ok {
+		t.Fatalf("deleted pod must not be cached")
+	}
+
+	replica := controllerPod("rep-0", "10.0.0.3", corev1.PodRunning)
+	replica.Labels["openebs.io/component"] = "jiva-replica"
+	eps.OnAdd(replica)
+	if _, ok := eps.get(key); ok {
+		t.Fatalf("replica pod must not be cached")
+	}
+}
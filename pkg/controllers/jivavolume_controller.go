@@ -49,10 +49,15 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
 )
@@ -62,28 +67,62 @@ type JivaVolumeReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+	// MaxConcurrentReconciles is the number of volumes
+	// that can be reconciled in parallel
+	MaxConcurrentReconciles int
+	// SyncingPollInterval is the interval at which the status of a
+	// volume is polled while it is Syncing or its status is Unknown
+	SyncingPollInterval time.Duration
+	// ReadyPollInterval is the interval at which the status
+	// of a volume is polled while it is Ready
+	ReadyPollInterval time.Duration
+	// MaxUpgradeFailures is the number of failed attempts after which
+	// the upgrade of a volume is rolled back, 0 disables the rollback
+	MaxUpgradeFailures int
+	// UpgradeTimeout is the time after which an attempt to upgrade a
+	// volume which has not completed is counted as failed, so that an
+	// upgrade stuck on a crashing component is rolled back, 0 disables it
+	UpgradeTimeout time.Duration
+
+	endpoints *targetEndpoints
 }
 
-type upgradeParams struct {
-	j      *openebsiov1alpha1.JivaVolume
-	client client.Client
-}
-
-type upgradeFunc func(u *upgradeParams) (*openebsiov1alpha1.JivaVolume, error)
-
-var (
-	upgradeMap  = map[string]upgradeFunc{}
-	podIPMap    = map[string]string{}
-	selectorMap = map[string]string{}
-)
-
 const (
 	pdbAPIVersion            = "policyv1beta1"
 	defaultStorageClass      = "openebs-hostpath"
-	replicaAntiAffinityKey   = "openebs.io/replica-anti-affinity"
+	replicaAntiAffinityKey   = openebsiov1alpha1.ReplicaAntiAffinityKey
 	defaultReplicationFactor = 3
 	defaultDisableMonitor    = false
 	openebsPVC               = "openebs.io/persistent-volume-claim"
+	// jivaVolumeFinalizer protects the JivaVolume from being removed
+	// before its components and replica data are cleaned up
+	jivaVolumeFinalizer = "openebs.io/jiva-volume-protection"
+	// controllerPodRequeueInterval is the interval after which a volume
+	// waiting for the controller pod to come up is reconciled again
+	controllerPodRequeueInterval = 5 * time.Second
+	// replicaPodRequeueInterval is the interval after which a volume is
+	// reconciled again once a replica pod is deleted to be recreated
+	replicaPodRequeueInterval = 10 * time.Second
+	// upgradeRetryInterval is the interval after which a failed upgrade
+	// is retried, so that the failures counted against the rollback of
+	// the upgrade are spread over a while
+	upgradeRetryInterval = 30 * time.Second
+	// only the reads of the jiva controller are retried, as a change which
+	// timed out may have been applied, it is retried on the next reconcile
+	controllerReqRetryCount    = 3
+	controllerReqRetryInterval = time.Second
+	// controllerReqTimeout is the timeout of a request to the jiva
+	// controller or a replica, and controllerReqDeadline bounds a call
+	// along with its retries so that the reconcile is not held up
+	controllerReqTimeout  = 2 * time.Second
+	controllerReqDeadline = 10 * time.Second
+	// minScaledownReplicationFactor is the lowest replication factor a
+	// volume can be scaled down to, as a replica is only removed while
+	// the remaining ones form the qurom
+	minScaledownReplicationFactor = 2
+	// scaledownRejectedReason is the reason of the ScalingInProgress
+	// condition once a scaledown which breaks the qurom is rejected
+	scaledownRejectedReason = "ScaledownRejected"
 )
 
 type policyOptFuncs func(*openebsiov1alpha1.JivaVolumePolicySpec, openebsiov1alpha1.JivaVolumePolicySpec)
@@ -91,12 +130,21 @@ type policyOptFuncs func(*openebsiov1alpha1.JivaVolumePolicySpec, openebsiov1alp
 var (
 	installFuncs = []func(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error{
 		populateJivaVolumePolicy,
+		checkVolumeSource,
 		createControllerService,
 		createControllerDeployment,
 		createReplicaStatefulSet,
 		createReplicaPodDisruptionBudget,
 	}
 
+	teardownFuncs = []func(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error{
+		deleteControllerDeployment,
+		deleteControllerService,
+		deleteReplicaPodDisruptionBudget,
+		deleteReplicaStatefulSet,
+		deleteReplicaPVCs,
+	}
+
 	updateErrMsg = "failed to update JivaVolume with service info"
 
 	defaultServiceAccountName = os.Getenv("OPENEBS_SERVICEACCOUNT_NAME")
@@ -122,6 +170,7 @@ func (r *JivaVolumeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	err := r.Get(context.TODO(), req.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
+			r.endpoints.invalidate(req.NamespacedName)
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
@@ -131,7 +180,26 @@ func (r *JivaVolumeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return reconcile.Result{}, err
 	}
 
-	err = r.reconcileVersion(instance)
+	// the replica PVCs are not owned by the JivaVolume, so the
+	// components are torn down explicitly before the volume is gone
+	if instance.DeletionTimestamp != nil {
+		if !controllerutil.ContainsFinalizer(instance, jivaVolumeFinalizer) {
+			return reconcile.Result{}, nil
+		}
+		logrus.Info("start tearing down jiva components", "JivaVolume: ", instance.Name)
+		return reconcile.Result{}, r.teardownJiva(instance)
+	}
+
+	if !controllerutil.ContainsFinalizer(instance, jivaVolumeFinalizer) {
+		err = r.patchJivaVolume(instance, func(j *openebsiov1alpha1.JivaVolume) {
+			controllerutil.AddFinalizer(j, jivaVolumeFinalizer)
+		})
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	upgrading, err := r.reconcileVersion(instance)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
@@ -141,13 +209,18 @@ func (r *JivaVolumeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return reconcile.Result{}, err
 	}
 
-	if _, ok := podIPMap[instance.Name]; !ok {
-		err = r.updatePodIPMap(instance)
+	result := reconcile.Result{}
+	if upgrading {
+		// check on the restarted components of the upgrade
+		result.RequeueAfter = replicaPodRequeueInterval
+	}
+	if _, ok := r.endpoints.get(req.NamespacedName); !ok {
+		err = r.resolveTargetEndpoint(instance)
 		if err != nil {
 			// log err only, as controller must be in container creating state
 			// don't return err as it will dump stack trace unneccesary
 			logrus.Infof("not able to get controller pod ip for volume %s: %s", instance.Name, err.Error())
-			time.Sleep(1 * time.Second)
+			result.RequeueAfter = controllerPodRequeueInterval
 		}
 	}
 
@@ -163,6 +236,27 @@ func (r *JivaVolumeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
+		if err := r.completeScaleup(instance); err != nil {
+			return reconcile.Result{}, err
+		}
+		if upgrading {
+			// the replicas are not scaled or moved
+			// while they are restarted by the upgrade
+			return r.pollStatus(result, instance), nil
+		}
+		if !ok {
+			// the volume is not on the version of the operator, so
+			// its replicas are not changed other than the ones being
+			// restored by the rollback of its upgrade
+			restoring, err := r.restoreReplicas(instance)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			if restoring {
+				result.RequeueAfter = replicaPodRequeueInterval
+			}
+			return r.pollStatus(result, instance), nil
+		}
 		if r.isScaleup(instance) {
 			logrus.Info("performing scaleup operation on " + instance.Name)
 			err = r.performScaleup(instance)
@@ -172,31 +266,81 @@ func (r *JivaVolumeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 				return reconcile.Result{}, fmt.Errorf("failed to scaleup volume %s: %s",
 					instance.Name, err.Error())
 			}
-			return reconcile.Result{}, r.getAndUpdateVolumeStatus(instance)
+			if err := r.getAndUpdateVolumeStatus(instance); err != nil {
+				return reconcile.Result{}, err
+			}
+			return r.pollStatus(result, instance), nil
 		}
-		if err := r.moveReplicasForMissingNodes(instance); err != nil {
+		rejected, err := r.rejectScaledown(instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if rejected {
+			return r.pollStatus(result, instance), nil
+		}
+		if r.isScaledown(instance) {
+			logrus.Info("performing scaledown operation on " + instance.Name)
+			err = r.performScaledown(instance)
+			if err != nil {
+				r.Recorder.Eventf(instance, corev1.EventTypeWarning,
+					"ReplicaScaledown", "failed to scaledown volume, due to error: %v", err)
+				return reconcile.Result{}, fmt.Errorf("failed to scaledown volume %s: %s",
+					instance.Name, err.Error())
+			}
+			if err := r.getAndUpdateVolumeStatus(instance); err != nil {
+				return reconcile.Result{}, err
+			}
+			return r.pollStatus(result, instance), nil
+		}
+		moved, err := r.moveReplicasForMissingNodes(instance)
+		if err != nil {
 			r.Recorder.Eventf(instance, corev1.EventTypeWarning,
 				"ReplicaMovement", "failed to move replica, due to error: %v", err)
 			return reconcile.Result{}, fmt.Errorf("failed to move replica %s: %s",
 				instance.Name, err.Error())
 		}
-		return reconcile.Result{}, nil
+		if moved {
+			// check for the recreated replica pod once
+			// the deleted pod is gone
+			result.RequeueAfter = replicaPodRequeueInterval
+			return r.pollStatus(result, instance), nil
+		}
+		rollingOut, err := r.rolloutPolicy(instance)
+		if err != nil {
+			r.Recorder.Eventf(instance, corev1.EventTypeWarning,
+				"PolicyUpdate", "failed to update policy, due to error: %v", err)
+			return reconcile.Result{}, fmt.Errorf("failed to update policy of volume %s: %s",
+				instance.Name, err.Error())
+		}
+		if rollingOut {
+			result.RequeueAfter = replicaPodRequeueInterval
+		}
+		return r.pollStatus(result, instance), nil
 	case openebsiov1alpha1.JivaVolumePhaseSyncing, openebsiov1alpha1.JivaVolumePhaseUnkown:
-		return reconcile.Result{}, r.getAndUpdateVolumeStatus(instance)
+		if err := r.getAndUpdateVolumeStatus(instance); err != nil {
+			return reconcile.Result{}, err
+		}
+		return r.pollStatus(result, instance), nil
 	case openebsiov1alpha1.JivaVolumePhaseDeleting:
-		logrus.Info("start tearing down jiva components", "JivaVolume: ", instance.Name)
+		// teardown is triggered by the deletion timestamp
 		return reconcile.Result{}, nil
 	case "", openebsiov1alpha1.JivaVolumePhasePending, openebsiov1alpha1.JivaVolumePhaseFailed:
 		if ok {
 			logrus.Info("start bootstraping jiva components", "JivaVolume: ", instance.Name)
-			return reconcile.Result{}, r.bootstrapJiva(instance)
+			// the volume is not requeued by the update of its
+			// phase, so the syncing volume is polled from here
+			err := r.bootstrapJiva(instance)
+			return r.pollStatus(result, instance), err
 		}
 	}
 
-	return reconcile.Result{}, nil
+	return result, nil
 }
 
-func (r *JivaVolumeReconciler) updatePodIPMap(cr *openebsiov1alpha1.JivaVolume) error {
+// resolveTargetEndpoint looks up the running controller pod of the volume
+// on a ready node, it is used when the pod informer has not yet provided
+// the controller pod IP or the cached IP is no longer reachable
+func (r *JivaVolumeReconciler) resolveTargetEndpoint(cr *openebsiov1alpha1.JivaVolume) error {
 	var (
 		controllerLabel = "openebs.io/component=jiva-controller,openebs.io/persistent-volume="
 	)
@@ -214,7 +358,7 @@ func (r *JivaVolumeReconciler) updatePodIPMap(cr *openebsiov1alpha1.JivaVolume)
 		return err
 	}
 
-	runningPodIPs := []string{}
+	runningPods := []corev1.Pod{}
 
 	for _, pod := range pods.Items {
 		node := &corev1.Node{}
@@ -222,14 +366,16 @@ func (r *JivaVolumeReconciler) updatePodIPMap(cr *openebsiov1alpha1.JivaVolume)
 			Name: pod.Spec.NodeName,
 		}, node)
 		if err == nil && isNodeReady(node) {
-			runningPodIPs = append(runningPodIPs, pod.Status.PodIP)
+			runningPods = append(runningPods, pod)
 		}
 	}
 
-	if len(runningPodIPs) != 1 {
+	key := types.NamespacedName{Name: cr.Name, Namespace: cr.Namespace}
+	if len(runningPods) != 1 {
+		r.endpoints.invalidate(key)
 		return fmt.Errorf("expected 1 controller pod got %d", len(pods.Items))
 	}
-	podIPMap[cr.Name] = runningPodIPs[0]
+	r.endpoints.set(key, runningPods[0].Name, runningPods[0].Status.PodIP)
 
 	return nil
 }
@@ -245,35 +391,97 @@ func isNodeReady(node *corev1.Node) bool {
 	return false
 }
 
+// isScaleup checks if a replica can be added to the volume, a scaleup
+// of more than one replica is carried out one replica at a time and
+// the next step waits for all the replicas to be in RW mode
 func (r *JivaVolumeReconciler) isScaleup(cr *openebsiov1alpha1.JivaVolume) bool {
 	if cr.Spec.DesiredReplicationFactor > cr.Spec.Policy.Target.ReplicationFactor {
+		// the step recorded in the status is not applied to the
+		// policy yet, i.e. the previous scaleup was interrupted
+		if cr.Status.Scaleup != nil &&
+			cr.Status.Scaleup.ReplicationFactor > cr.Spec.Policy.Target.ReplicationFactor {
+			logrus.Infof("resuming scaleup of volume %v to replicationfactor: %v",
+				cr.Name, cr.Status.Scaleup.ReplicationFactor)
+			return true
+		}
 		if cr.Spec.Policy.Target.ReplicationFactor != cr.Status.ReplicaCount {
-			r.Recorder.Eventf(cr, corev1.EventTypeWarning,
-				"ReplicaScaleup", "failed to scaleup volume, replica count: %v in status not equal to replicationfactor: %v",
-				cr.Status.ReplicaCount, cr.Spec.Policy.Target.ReplicationFactor)
-			logrus.Errorf("failed to scaleup, replica count: %v in status not equal to replicationfactor: %v",
-				cr.Status.ReplicaCount, cr.Spec.Policy.Target.ReplicationFactor)
+			logrus.Infof("waiting for replica count: %v of volume %v to reach replicationfactor: %v",
+				cr.Status.ReplicaCount, cr.Name, cr.Spec.Policy.Target.ReplicationFactor)
 			return false
 		}
 		for _, rep := range cr.Status.ReplicaStatuses {
 			if rep.Mode != "RW" {
-				r.Recorder.Eventf(cr, corev1.EventTypeWarning,
-					"ReplicaScaleup", "failed to scaleup volume, all replicas for volume %v should be in RW state", cr.Name)
-				logrus.Errorf("failed to scaleup, all replicas for volume %v should be in RW state", cr.Name)
+				logrus.Infof("waiting for all replicas of volume %v to be in RW state", cr.Name)
 				return false
 			}
 		}
-		if cr.Spec.DesiredReplicationFactor-cr.Spec.Policy.Target.ReplicationFactor != 1 {
+		return true
+	}
+	return false
+}
+
+// rejectScaledown resets the desired replication factor to the current
+// one if the replicas can't be scaled down to it without losing the
+// qurom, so that the scaledown is refused once instead of being retried
+// on every reconcile. The refusal is recorded in the ScalingInProgress
+// condition till the desired replication factor is changed again.
+func (r *JivaVolumeReconciler) rejectScaledown(cr *openebsiov1alpha1.JivaVolume) (bool, error) {
+	desired := cr.Spec.DesiredReplicationFactor
+	rf := cr.Spec.Policy.Target.ReplicationFactor
+	if desired <= 0 || desired >= rf || desired >= minScaledownReplicationFactor {
+		return false, nil
+	}
+
+	msg := fmt.Sprintf("desired replication factor %d is rejected, the replicas can't be scaled down "+
+		"below %d without losing the qurom", desired, minScaledownReplicationFactor)
+	err := r.patchJivaVolume(cr, func(j *openebsiov1alpha1.JivaVolume) {
+		j.Spec.DesiredReplicationFactor = j.Spec.Policy.Target.ReplicationFactor
+	})
+	if err != nil {
+		return false, err
+	}
+	r.Recorder.Eventf(cr, corev1.EventTypeWarning, "ReplicaScaledown", msg)
+	logrus.Warningf("volume %s: %s", cr.Name, msg)
+
+	setCondition(cr, openebsiov1alpha1.JivaVolumeConditionScalingInProgress,
+		metav1.ConditionFalse, scaledownRejectedReason, msg)
+	return true, r.updateJivaVolumeStatus(cr)
+}
+
+// isScaledown checks if a replica can be removed from the volume, it
+// is refused if the remaining replicas can't form the qurom of the
+// current replication factor as the controller would turn the volume RO
+func (r *JivaVolumeReconciler) isScaledown(cr *openebsiov1alpha1.JivaVolume) bool {
+	if cr.Spec.DesiredReplicationFactor <= 0 ||
+		cr.Spec.DesiredReplicationFactor >= cr.Spec.Policy.Target.ReplicationFactor {
+		return false
+	}
+	if cr.Spec.Policy.Target.ReplicationFactor != cr.Status.ReplicaCount {
+		r.Recorder.Eventf(cr, corev1.EventTypeWarning,
+			"ReplicaScaledown", "failed to scaledown volume, replica count: %v in status not equal to replicationfactor: %v",
+			cr.Status.ReplicaCount, cr.Spec.Policy.Target.ReplicationFactor)
+		logrus.Errorf("failed to scaledown, replica count: %v in status not equal to replicationfactor: %v",
+			cr.Status.ReplicaCount, cr.Spec.Policy.Target.ReplicationFactor)
+		return false
+	}
+	for _, rep := range cr.Status.ReplicaStatuses {
+		if rep.Mode != "RW" {
 			r.Recorder.Eventf(cr, corev1.EventTypeWarning,
-				"ReplicaScaleup", "failed to scaleup volume, only single replica scaleup is allowed, desired: %v actual: %v",
-				cr.Spec.DesiredReplicationFactor, cr.Spec.Policy.Target.ReplicationFactor)
-			logrus.Errorf("failed to scaleup, only single replica scaleup is allowed, desired: %v actual: %v",
-				cr.Spec.DesiredReplicationFactor, cr.Spec.Policy.Target.ReplicationFactor)
+				"ReplicaScaledown", "failed to scaledown volume, all replicas for volume %v should be in RW state", cr.Name)
+			logrus.Errorf("failed to scaledown, all replicas for volume %v should be in RW state", cr.Name)
 			return false
 		}
-		return true
 	}
-	return false
+	qurom := (cr.Spec.Policy.Target.ReplicationFactor / 2) + 1
+	if cr.Spec.Policy.Target.ReplicationFactor-1 < qurom {
+		r.Recorder.Eventf(cr, corev1.EventTypeWarning,
+			"ReplicaScaledown", "failed to scaledown volume, removing a replica breaks qurom of replicationfactor: %v",
+			cr.Spec.Policy.Target.ReplicationFactor)
+		logrus.Errorf("failed to scaledown, removing a replica breaks qurom of replicationfactor: %v",
+			cr.Spec.Policy.Target.ReplicationFactor)
+		return false
+	}
+	return true
 }
 
 // isHAVolume checks if the volume has atleast
@@ -295,12 +503,16 @@ func isHAVolume(cr *openebsiov1alpha1.JivaVolume) bool {
 	return false
 }
 
-func (r *JivaVolumeReconciler) moveReplicasForMissingNodes(cr *openebsiov1alpha1.JivaVolume) error {
+// moveReplicasForMissingNodes deletes the pending replica pods whose PVC
+// is missing or bound to a node which no longer exists, so that they are
+// recreated on another node. A single replica is moved per call and true
+// is returned if a replica pod was deleted.
+func (r *JivaVolumeReconciler) moveReplicasForMissingNodes(cr *openebsiov1alpha1.JivaVolume) (bool, error) {
 
 	// if the volume does not HA replicas in
 	// RW mode skip the process
 	if !isHAVolume(cr) {
-		return nil
+		return false, nil
 	}
 
 	var (
@@ -310,7 +522,7 @@ func (r *JivaVolumeReconciler) moveReplicasForMissingNodes(cr *openebsiov1alpha1
 	labelSelector, err := labels.Parse(
 		replicaLabel + cr.Name)
 	if err != nil {
-		return err
+		return false, err
 	}
 	pods := corev1.PodList{}
 	err = r.List(context.TODO(), &pods, &client.ListOptions{
@@ -318,7 +530,7 @@ func (r *JivaVolumeReconciler) moveReplicasForMissingNodes(cr *openebsiov1alpha1
 		LabelSelector: labelSelector,
 	})
 	if err != nil {
-		return err
+		return false, err
 	}
 	for _, pod := range pods.Items {
 		// perform steps only if the pod is in pending state
@@ -336,15 +548,12 @@ func (r *JivaVolumeReconciler) moveReplicasForMissingNodes(cr *openebsiov1alpha1
 			// delete the sts pod
 			if errors.IsNotFound(err) {
 				err = r.Delete(context.TODO(), &pod)
-				// wait for pod to get deleted and
-				// recreated
-				time.Sleep(10 * time.Second)
 				if err != nil && !errors.IsNotFound(err) {
-					return err
+					return false, err
 				}
-				continue
+				return true, nil
 			}
-			return err
+			return false, err
 		}
 		nodeName := pvc.GetAnnotations()[nodeAnnotation]
 		// if a pvc and pod is deleted then in next iteration the nodeName
@@ -359,27 +568,24 @@ func (r *JivaVolumeReconciler) moveReplicasForMissingNodes(cr *openebsiov1alpha1
 				if errors.IsNotFound(err) {
 					err = r.removeSTSVolume(pvc)
 					if err != nil {
-						return err
+						return false, err
 					}
 					err = r.Delete(context.TODO(), &pod)
 					if err != nil {
-						return err
+						return false, err
 					}
-					// wait for pod to get deleted and
-					// recreated
-					time.Sleep(10 * time.Second)
 					r.Recorder.Eventf(cr, corev1.EventTypeWarning,
 						"ReplicaMovement",
 						"replica %s and it's corresponding PVC & PV deleted",
 						pod.Name,
 					)
-				} else {
-					return err
+					return true, nil
 				}
+				return false, err
 			}
 		}
 	}
-	return nil
+	return false, nil
 }
 
 // remove the stale PVC and PV for the missing node
@@ -431,11 +637,34 @@ func (r *JivaVolumeReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}); err != nil {
 		return err
 	}
+	if err := mgr.GetFieldIndexer().IndexField(context.TODO(), &corev1.Pod{}, podNodeNameField, func(rawObj client.Object) []string {
+		pod := rawObj.(*corev1.Pod)
+		return []string{pod.Spec.NodeName}
+	}); err != nil {
+		return err
+	}
+	// keep the controller pod IPs up to date from the pod informer
+	r.endpoints = newTargetEndpoints()
+	podInformer, err := mgr.GetCache().GetInformer(context.TODO(), &corev1.Pod{})
+	if err != nil {
+		return err
+	}
+	podInformer.AddEventHandler(r.endpoints)
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&openebsiov1alpha1.JivaVolume{}).
+		For(&openebsiov1alpha1.JivaVolume{}, builder.WithPredicates(jivaVolumePredicate)).
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
 		Owns(&appsv1.StatefulSet{}).
+		Owns(&policyv1beta1.PodDisruptionBudget{}).
+		// the pods are owned by the deployment and statefulset,
+		// so they are mapped to the volume through the labels
+		Watches(&source.Kind{Type: &corev1.Pod{}},
+			handler.EnqueueRequestsFromMapFunc(jivaVolumeForPod),
+			builder.WithPredicates(jivaPodPredicate)).
+		Watches(&source.Kind{Type: &corev1.Node{}},
+			handler.EnqueueRequestsFromMapFunc(r.jivaVolumesForNode),
+			builder.WithPredicates(nodeReadinessPredicate)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
 
@@ -447,7 +676,7 @@ func (r *JivaVolumeReconciler) finally(err error, cr *openebsiov1alpha1.JivaVolu
 		cr.Status.Phase = openebsiov1alpha1.JivaVolumePhaseSyncing
 	}
 
-	if err := r.updateJivaVolume(cr); err != nil {
+	if err := r.updateJivaVolumeStatus(cr); err != nil {
 		logrus.Error(err, "failed to update JivaVolume phase")
 	}
 }
@@ -457,6 +686,13 @@ func (r *JivaVolumeReconciler) shouldReconcile(cr *openebsiov1alpha1.JivaVolume)
 	jivaVolumeVersion := cr.VersionDetails.Status.Current
 
 	if jivaVolumeVersion != operatorVersion {
+		// the volume is still monitored while it is upgraded or after
+		// its upgrade is rolled back, but its components are not
+		// created with the images of the operator
+		if cr.VersionDetails.Status.State == openebsiov1alpha1.ReconcileInProgress ||
+			isRolledBack(cr) {
+			return false, nil
+		}
 		return false, fmt.Errorf("jiva operator version is %s but volume %s version is %s",
 			operatorVersion, cr.Name, jivaVolumeVersion)
 	}
@@ -479,6 +715,143 @@ func (r *JivaVolumeReconciler) bootstrapJiva(cr *openebsiov1alpha1.JivaVolume) (
 	return err
 }
 
+// 1. Delete controller deploy
+// 2. Delete controller svc
+// 3. Delete replica pdb
+// 4. Delete replica statefulset
+// 5. Delete replica pvcs
+func (r *JivaVolumeReconciler) teardownJiva(cr *openebsiov1alpha1.JivaVolume) error {
+	if cr.Status.Phase != openebsiov1alpha1.JivaVolumePhaseDeleting {
+		cr.Status.Phase = openebsiov1alpha1.JivaVolumePhaseDeleting
+		if err := r.updateJivaVolumeStatus(cr); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal,
+			"Teardown", "tearing down jiva components")
+	}
+
+	for _, f := range teardownFuncs {
+		if err := f(r, cr); err != nil {
+			r.Recorder.Eventf(cr, corev1.EventTypeWarning,
+				"Teardown", "failed to teardown volume, due to error: %v", err)
+			return err
+		}
+	}
+
+	r.endpoints.invalidate(types.NamespacedName{Name: cr.Name, Namespace: cr.Namespace})
+
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal,
+		"Teardown", "jiva components and replica data deleted")
+	return r.patchJivaVolume(cr, func(j *openebsiov1alpha1.JivaVolume) {
+		controllerutil.RemoveFinalizer(j, jivaVolumeFinalizer)
+	})
+}
+
+// deleteObject deletes the given object, an already
+// deleted object is not considered as an error
+func (r *JivaVolumeReconciler) deleteObject(obj client.Object) error {
+	logrus.Info("Deleting object ", obj.GetNamespace(), "/", obj.GetName())
+	if err := r.Delete(context.TODO(), obj); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s, err: %v", obj.GetName(), err)
+	}
+	return nil
+}
+
+func deleteControllerDeployment(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
+	return r.deleteObject(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cr.Name + "-jiva-ctrl",
+			Namespace: cr.Namespace,
+		},
+	})
+}
+
+func deleteControllerService(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
+	return r.deleteObject(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cr.Name + "-jiva-ctrl-svc",
+			Namespace: cr.Namespace,
+		},
+	})
+}
+
+func deleteReplicaPodDisruptionBudget(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
+	return r.deleteObject(&policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cr.Name + "-pdb",
+			Namespace: cr.Namespace,
+		},
+	})
+}
+
+func deleteReplicaStatefulSet(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
+	return r.deleteObject(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cr.Name + "-jiva-rep",
+			Namespace: cr.Namespace,
+		},
+	})
+}
+
+// deleteReplicaPVCs deletes the PVCs created from the volumeClaimTemplates
+// of the replica statefulset, these are not garbage collected along with
+// the statefulset. The PVCs are removed by kubernetes once the replica pods
+// are gone, which releases the PVs and the replica data with them.
+func deleteReplicaPVCs(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(context.TODO(), pvcs, client.InNamespace(cr.Namespace)); err != nil {
+		return fmt.Errorf("failed to list replica pvcs, err: %v", err)
+	}
+
+	prefix := "openebs-" + cr.Name + "-jiva-rep-"
+	for i := range pvcs.Items {
+		claim := &pvcs.Items[i]
+		if !strings.HasPrefix(claim.Name, prefix) || claim.DeletionTimestamp != nil {
+			continue
+		}
+		if err := r.deleteObject(claim); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal,
+			"Teardown", "replica pvc %s deleted", claim.Name)
+	}
+	return nil
+}
+
+// checkVolumeSource verifies that the source volume of a cloned
+// volume is ready before bootstrapping the jiva components
+func checkVolumeSource(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
+	if cr.Spec.VolumeSource == nil {
+		return nil
+	}
+	_, err := r.getSourceVolume(cr)
+	return err
+}
+
+// getSourceVolume returns the JivaVolume the data of the given
+// volume is cloned from
+func (r *JivaVolumeReconciler) getSourceVolume(cr *openebsiov1alpha1.JivaVolume) (*openebsiov1alpha1.JivaVolume, error) {
+	src := &openebsiov1alpha1.JivaVolume{}
+	if err := r.Get(context.TODO(),
+		types.NamespacedName{
+			Name:      cr.Spec.VolumeSource.SourceVolume,
+			Namespace: cr.Namespace,
+		}, src); err != nil {
+		return nil, fmt.Errorf("failed to get source volume %s, err: %v",
+			cr.Spec.VolumeSource.SourceVolume, err)
+	}
+
+	if src.Status.Phase != openebsiov1alpha1.JivaVolumePhaseReady {
+		return nil, fmt.Errorf("source volume %s is not ready, phase: %s",
+			src.Name, src.Status.Phase)
+	}
+
+	if len(src.Spec.ISCSISpec.TargetIP) == 0 {
+		return nil, fmt.Errorf("target IP of source volume %s is empty", src.Name)
+	}
+	return src, nil
+}
+
 // TODO: add logic to create disruption budget for replicas
 func createReplicaPodDisruptionBudget(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
 	min := cr.Spec.Policy.Target.ReplicationFactor
@@ -524,10 +897,153 @@ func createReplicaPodDisruptionBudget(r *JivaVolumeReconciler, cr *openebsiov1al
 	return nil
 }
 
+// performScaleup adds a single replica to the volume. The step is
+// recorded in the status before the replicas are changed, so that an
+// interrupted scaleup is resumed from the recorded step
 func (r *JivaVolumeReconciler) performScaleup(cr *openebsiov1alpha1.JivaVolume) error {
-	// update the replica sts with the desired replica count
+	replicas := cr.Spec.Policy.Target.ReplicationFactor + 1
+
+	if cr.Status.Scaleup == nil {
+		cr.Status.Scaleup = &openebsiov1alpha1.ScaleupStatus{
+			InitialReplicationFactor: replicas - 1,
+		}
+	}
+	cr.Status.Scaleup.DesiredReplicationFactor = cr.Spec.DesiredReplicationFactor
+	cr.Status.Scaleup.ReplicationFactor = replicas
+	setCondition(cr, openebsiov1alpha1.JivaVolumeConditionScalingInProgress,
+		metav1.ConditionTrue, "ScalingUp",
+		fmt.Sprintf("scaling up replicas to %d of desired %d", replicas, cr.Spec.DesiredReplicationFactor))
+	if err := r.updateJivaVolumeStatus(cr); err != nil {
+		return fmt.Errorf("failed to update JivaVolume scaleup status: %s", err.Error())
+	}
+
+	// update the replica sts with the next replica count
 	// this will bring a new hostpath pvc on a new node and a
 	// new pod
+	if err := r.scaleReplicaStatefulSet(cr, replicas); err != nil {
+		return err
+	}
+
+	// update the controller envs to the next replica count
+	if err := r.updateControllerReplicationFactor(cr, replicas); err != nil {
+		return err
+	}
+
+	err := r.patchJivaVolume(cr, func(j *openebsiov1alpha1.JivaVolume) {
+		j.Spec.Policy.Target.ReplicationFactor = replicas
+	})
+	if err != nil {
+		return err
+	}
+
+	cr.Status.Phase = openebsiov1alpha1.JivaVolumePhaseSyncing
+	if err := r.updateJivaVolumeStatus(cr); err != nil {
+		return fmt.Errorf("failed to update JivaVolume phase: %s", err.Error())
+	}
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal,
+		"ReplicaScaleup", "scaling up replicas to %v of desired %v",
+		replicas, cr.Spec.DesiredReplicationFactor)
+	return nil
+}
+
+// completeScaleup clears the scaleup progress from the status once
+// all the replicas of the last step are in RW mode, or the desired
+// replication factor is lowered while the scaleup is in progress
+func (r *JivaVolumeReconciler) completeScaleup(cr *openebsiov1alpha1.JivaVolume) error {
+	if cr.Status.Scaleup == nil ||
+		cr.Spec.DesiredReplicationFactor > cr.Spec.Policy.Target.ReplicationFactor {
+		return nil
+	}
+	if cr.Status.ReplicaCount != cr.Spec.Policy.Target.ReplicationFactor {
+		return nil
+	}
+	for _, rep := range cr.Status.ReplicaStatuses {
+		if rep.Mode != "RW" {
+			return nil
+		}
+	}
+	initial := cr.Status.Scaleup.InitialReplicationFactor
+	cr.Status.Scaleup = nil
+	if err := r.updateJivaVolumeStatus(cr); err != nil {
+		return fmt.Errorf("failed to update JivaVolume scaleup status: %s", err.Error())
+	}
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal,
+		"ReplicaScaleup", "scaled up replicas from %v to %v",
+		initial, cr.Spec.Policy.Target.ReplicationFactor)
+	return nil
+}
+
+// performScaledown removes a single replica from the volume. The replica
+// with the highest ordinal is picked as that is the pod the statefulset
+// removes when it is scaled down.
+func (r *JivaVolumeReconciler) performScaledown(cr *openebsiov1alpha1.JivaVolume) error {
+	replicas := cr.Spec.Policy.Target.ReplicationFactor - 1
+	podName := cr.Name + "-jiva-rep-" + strconv.Itoa(replicas)
+
+	// remove the replica from the jiva controller so that IOs are
+	// not served from it while the pod is being terminated
+	pod := &corev1.Pod{}
+	err := r.Get(context.TODO(),
+		types.NamespacedName{Name: podName, Namespace: cr.Namespace}, pod)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && pod.Status.PodIP != "" {
+		address := "tcp://" + pod.Status.PodIP + ":9502"
+		for _, rep := range cr.Status.ReplicaStatuses {
+			if rep.Address != address {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.TODO(), controllerReqDeadline)
+			defer cancel()
+			if err := newControllerClient(r.controllerAddress(cr)).DeleteReplica(ctx, address); err != nil {
+				return fmt.Errorf("failed to remove replica %s from controller: %s", podName, err.Error())
+			}
+			break
+		}
+	}
+
+	if err := r.scaleReplicaStatefulSet(cr, replicas); err != nil {
+		return err
+	}
+
+	if err := r.updateControllerReplicationFactor(cr, replicas); err != nil {
+		return err
+	}
+
+	// the pvc is protected by kubernetes till the replica pod is
+	// gone, so it is safe to delete it while the pod terminates
+	err = r.deleteObject(&corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "openebs-" + podName,
+			Namespace: cr.Namespace,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal,
+		"ReplicaScaledown", "replica %s and it's corresponding PVC deleted", podName)
+
+	err = r.patchJivaVolume(cr, func(j *openebsiov1alpha1.JivaVolume) {
+		j.Spec.Policy.Target.ReplicationFactor = replicas
+	})
+	if err != nil {
+		return err
+	}
+
+	cr.Status.Phase = openebsiov1alpha1.JivaVolumePhaseSyncing
+	setCondition(cr, openebsiov1alpha1.JivaVolumeConditionScalingInProgress,
+		metav1.ConditionTrue, "ScalingDown",
+		fmt.Sprintf("scaling down replicas to %d of desired %d", replicas, cr.Spec.DesiredReplicationFactor))
+	if err := r.updateJivaVolumeStatus(cr); err != nil {
+		return fmt.Errorf("failed to update JivaVolume phase: %s", err.Error())
+	}
+	return nil
+}
+
+// scaleReplicaStatefulSet updates the replica sts with the given replica count
+func (r *JivaVolumeReconciler) scaleReplicaStatefulSet(cr *openebsiov1alpha1.JivaVolume, replicas int) error {
 	replicaName := cr.Name + "-jiva-rep"
 	replicaSTS := &appsv1.StatefulSet{}
 	err := r.Get(context.TODO(),
@@ -535,47 +1051,47 @@ func (r *JivaVolumeReconciler) performScaleup(cr *openebsiov1alpha1.JivaVolume)
 	if err != nil {
 		return err
 	}
-	desiredReplicas := int32(cr.Spec.DesiredReplicationFactor)
+	desiredReplicas := int32(replicas)
 	newReplicaSTS := replicaSTS.DeepCopy()
 	newReplicaSTS.Spec.Replicas = &desiredReplicas
-	err = r.Patch(context.TODO(), newReplicaSTS, client.MergeFrom(replicaSTS))
-	if err != nil {
-		return err
-	}
+	return r.Patch(context.TODO(), newReplicaSTS, client.MergeFrom(replicaSTS))
+}
 
-	// update the controller envs to the desired replica count
+// updateControllerReplicationFactor updates the REPLICATION_FACTOR env
+// of the jiva controller to the given replica count
+func (r *JivaVolumeReconciler) updateControllerReplicationFactor(cr *openebsiov1alpha1.JivaVolume, replicas int) error {
 	controllerName := cr.Name + "-jiva-ctrl"
 	ctrlDeploy := &appsv1.Deployment{}
-	err = r.Get(context.TODO(),
+	err := r.Get(context.TODO(),
 		types.NamespacedName{Name: controllerName, Namespace: cr.Namespace}, ctrlDeploy)
 	if err != nil {
 		return err
 	}
 	newCtrlDeploy := ctrlDeploy.DeepCopy()
 	for i, con := range newCtrlDeploy.Spec.Template.Spec.Containers {
-		if con.Name == "jiva-controller" {
-			newCtrlDeploy.Spec.Template.Spec.Containers[i].Env[0].Value = strconv.Itoa(cr.Spec.DesiredReplicationFactor)
+		if con.Name != "jiva-controller" {
+			continue
+		}
+		for j, env := range con.Env {
+			if env.Name == "REPLICATION_FACTOR" {
+				newCtrlDeploy.Spec.Template.Spec.Containers[i].Env[j].Value = strconv.Itoa(replicas)
+			}
 		}
 	}
-	err = r.Patch(context.TODO(), newCtrlDeploy, client.MergeFrom(ctrlDeploy))
-	if err != nil {
-		return err
-	}
-
-	cr.Spec.Policy.Target.ReplicationFactor = int(desiredReplicas)
-	cr.Status.Phase = openebsiov1alpha1.JivaVolumePhaseSyncing
-	if err := r.updateJivaVolume(cr); err != nil {
-		return fmt.Errorf("failed to update JivaVolume phase: %s", err.Error())
-	}
-	return nil
+	return r.Patch(context.TODO(), newCtrlDeploy, client.MergeFrom(ctrlDeploy))
 }
 
-func createControllerDeployment(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
+// buildControllerDeployment builds the jiva controller
+// deployment from the policy of the volume
+func buildControllerDeployment(cr *openebsiov1alpha1.JivaVolume) (*appsv1.Deployment, error) {
 	reps := int32(1)
 
-	dep, err := deploy.NewBuilder().WithName(cr.Name + "-jiva-ctrl").
+	return deploy.NewBuilder().WithName(cr.Name + "-jiva-ctrl").
 		WithNamespace(cr.Namespace).
 		WithLabels(defaultControllerLabels(cr.Spec.PV, cr.GetLabels()[openebsPVC])).
+		WithAnnotations(map[string]string{
+			policyHashAnnotation: targetPolicyHash(cr.Spec.Policy),
+		}).
 		WithReplicas(&reps).
 		WithStrategyType(appsv1.RecreateDeploymentStrategyType).
 		WithSelectorMatchLabelsNew(defaultControllerMatchLabels(cr.Spec.PV, cr.GetLabels()[openebsPVC])).
@@ -645,7 +1161,10 @@ func createControllerDeployment(r *JivaVolumeReconciler, cr *openebsiov1alpha1.J
 				return ptsBuilder
 			}(),
 		).Build()
+}
 
+func createControllerDeployment(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
+	dep, err := buildControllerDeployment(cr)
 	if err != nil {
 		return fmt.Errorf("failed to build deployment object, err: %v", err)
 	}
@@ -783,12 +1302,16 @@ func defaultServiceLabels(pv string) map[string]string {
 	}
 }
 
-func createReplicaStatefulSet(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
+// buildReplicaStatefulSet builds the jiva replica statefulset from the
+// policy of the volume. The replicas of a cloned volume are set to sync
+// the data from the given source volume, which is only needed while
+// creating the statefulset.
+func (r *JivaVolumeReconciler) buildReplicaStatefulSet(cr *openebsiov1alpha1.JivaVolume,
+	src *openebsiov1alpha1.JivaVolume) (*appsv1.StatefulSet, error) {
 
 	var (
 		err                            error
 		replicaCount                   int32
-		stsObj                         *appsv1.StatefulSet
 		blockOwnerDeletion, controller = false, true
 		svcName                        = cr.Name + "-jiva-ctrl-svc"
 	)
@@ -801,7 +1324,7 @@ func createReplicaStatefulSet(r *JivaVolumeReconciler, cr *openebsiov1alpha1.Jiv
 		},
 		svc)
 	if err != nil {
-		return fmt.Errorf("failed to get svc %s, err: %v", svcName, err)
+		return nil, fmt.Errorf("failed to get svc %s, err: %v", svcName, err)
 	}
 
 	rc := cr.Spec.Policy.Target.ReplicationFactor
@@ -811,14 +1334,38 @@ func createReplicaStatefulSet(r *JivaVolumeReconciler, cr *openebsiov1alpha1.Jiv
 	size := strings.Split(cr.Spec.Capacity, "i")[0]
 	capacity, err := units.RAMInBytes(size)
 	if err != nil {
-		return fmt.Errorf("failed to convert human readable size: %v into int64, err: %v", cr.Spec.Capacity, err)
+		return nil, fmt.Errorf("failed to convert human readable size: %v into int64, err: %v", cr.Spec.Capacity, err)
+	}
+
+	args := []string{
+		"replica",
+		"--frontendIP",
+		svc.Spec.ClusterIP,
+		"--size",
+		fmt.Sprint(capacity),
+	}
+	// replicas of a cloned volume sync the data of the snapshot
+	// from the replicas of the source volume on startup
+	if cr.Spec.VolumeSource != nil && src != nil {
+		args = append(args,
+			"--type",
+			"clone",
+			"--cloneIP",
+			src.Spec.ISCSISpec.TargetIP,
+			"--snapName",
+			cr.Spec.VolumeSource.Snapshot,
+		)
 	}
+	args = append(args, "openebs")
 
 	defaultLabels := defaultReplicaLabels(cr.Spec.PV)
 
-	stsObj, err = sts.NewBuilder().
+	return sts.NewBuilder().
 		WithName(cr.Name + "-jiva-rep").
 		WithLabelsNew(defaultReplicaLabels(cr.Spec.PV)).
+		WithAnnotationsNew(map[string]string{
+			policyHashAnnotation: replicaPolicyHash(cr.Spec.Policy),
+		}).
 		WithNamespace(cr.Namespace).
 		WithServiceName("jiva-replica-svc").
 		WithPodManagementPolicy(appsv1.ParallelPodManagement).
@@ -839,14 +1386,7 @@ func createReplicaStatefulSet(r *JivaVolumeReconciler, cr *openebsiov1alpha1.Jiv
 							WithCommandNew([]string{
 								"launch",
 							}).
-							WithArgumentsNew([]string{
-								"replica",
-								"--frontendIP",
-								svc.Spec.ClusterIP,
-								"--size",
-								fmt.Sprint(capacity),
-								"openebs",
-							}).
+							WithArgumentsNew(args).
 							WithImagePullPolicy(corev1.PullIfNotPresent).
 							WithPrivilegedSecurityContext(&prev).
 							WithResources(cr.Spec.Policy.Replica.Resources).
@@ -869,10 +1409,13 @@ func createReplicaStatefulSet(r *JivaVolumeReconciler, cr *openebsiov1alpha1.Jiv
 				}
 				if cr.Spec.Policy.Replica.Affinity != nil {
 					if cr.Spec.Policy.Replica.Affinity.PodAntiAffinity != nil {
+						value := ""
 						for _, term := range cr.Spec.Policy.Replica.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
-							selectorMap, _ = metav1.LabelSelectorAsMap(term.LabelSelector)
+							if v, ok, err := openebsiov1alpha1.ReplicaAntiAffinityValue(term.LabelSelector); err == nil && ok {
+								value = v
+							}
 						}
-						defaultLabels[replicaAntiAffinityKey] = selectorMap[replicaAntiAffinityKey]
+						defaultLabels[replicaAntiAffinityKey] = value
 					}
 				}
 				ptsBuilder = ptsBuilder.WithLabels(defaultLabels)
@@ -923,7 +1466,17 @@ func createReplicaStatefulSet(r *JivaVolumeReconciler, cr *openebsiov1alpha1.Jiv
 				WithAccessModes([]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}).
 				WithCapacity(cr.Spec.Capacity),
 		).Build()
+}
 
+func createReplicaStatefulSet(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
+	var src *openebsiov1alpha1.JivaVolume
+	if cr.Spec.VolumeSource != nil {
+		var err error
+		if src, err = r.getSourceVolume(cr); err != nil {
+			return err
+		}
+	}
+	stsObj, err := r.buildReplicaStatefulSet(cr, src)
 	if err != nil {
 		return fmt.Errorf("failed to build statefulset object, err: %v", err)
 	}
@@ -950,15 +1503,7 @@ func createReplicaStatefulSet(r *JivaVolumeReconciler, cr *openebsiov1alpha1.Jiv
 	return nil
 }
 
-func updateJivaVolumeWithServiceInfo(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
-	ctrlSVC := &corev1.Service{}
-	if err := r.Get(context.TODO(),
-		types.NamespacedName{
-			Name:      cr.Name + "-jiva-ctrl-svc",
-			Namespace: cr.Namespace,
-		}, ctrlSVC); err != nil {
-		return fmt.Errorf("%s, err: %v", updateErrMsg, err)
-	}
+func updateJivaVolumeWithServiceInfo(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume, ctrlSVC *corev1.Service) error {
 	cr.Spec.ISCSISpec.TargetIP = ctrlSVC.Spec.ClusterIP
 	var found bool
 	for _, port := range ctrlSVC.Spec.Ports {
@@ -974,14 +1519,16 @@ func updateJivaVolumeWithServiceInfo(r *JivaVolumeReconciler, cr *openebsiov1alp
 	}
 
 	logrus.Info("Updating JivaVolume with iscsi spec", "ISCSISpec", cr.Spec.ISCSISpec)
-	cr.Status.Phase = openebsiov1alpha1.JivaVolumePhasePending
-	if err := r.Update(context.TODO(), cr); err != nil {
+	iscsiSpec := cr.Spec.ISCSISpec
+	err := r.patchJivaVolume(cr, func(j *openebsiov1alpha1.JivaVolume) {
+		j.Spec.ISCSISpec = iscsiSpec
+	})
+	if err != nil {
 		return fmt.Errorf("%s, err: %v", updateErrMsg, err)
 	}
 
-	// Update cr with the updated fields so that we don't get
-	// resourceVersion changed error in next steps
-	if err := r.getJivaVolume(cr); err != nil {
+	cr.Status.Phase = openebsiov1alpha1.JivaVolumePhasePending
+	if err := r.updateJivaVolumeStatus(cr); err != nil {
 		return fmt.Errorf("%s, err: %v", updateErrMsg, err)
 	}
 
@@ -1181,9 +1728,10 @@ func populateJivaVolumePolicy(r *JivaVolumeReconciler, cr *openebsiov1alpha1.Jiv
 		policySpec = policy.Spec
 		validatePolicySpec(&policySpec)
 	}
-	cr.Spec.Policy = policySpec
-	cr.Spec.DesiredReplicationFactor = policySpec.Target.ReplicationFactor
-	return nil
+	return r.patchJivaVolume(cr, func(j *openebsiov1alpha1.JivaVolume) {
+		j.Spec.Policy = policySpec
+		j.Spec.DesiredReplicationFactor = policySpec.Target.ReplicationFactor
+	})
 }
 
 func createControllerService(r *JivaVolumeReconciler, cr *openebsiov1alpha1.JivaVolume) error {
@@ -1217,26 +1765,72 @@ func createControllerService(r *JivaVolumeReconciler, cr *openebsiov1alpha1.Jiva
 		if err != nil {
 			return err
 		}
-		// Wait for service to get created
-		time.Sleep(1 * time.Second)
-		return updateJivaVolumeWithServiceInfo(r, cr)
+		// the cluster IP is allocated by the time create returns
+		return updateJivaVolumeWithServiceInfo(r, cr, svcObj)
 	} else if err != nil {
 		return operr.Wrapf(err, "failed to get the service details: %v", svcObj.Name)
 
 	}
 
-	return updateJivaVolumeWithServiceInfo(r, cr)
+	return updateJivaVolumeWithServiceInfo(r, cr, instance)
 
 }
 
-func (r *JivaVolumeReconciler) updateJivaVolume(cr *openebsiov1alpha1.JivaVolume) error {
-	if err := r.Update(context.TODO(), cr); err != nil {
-		return fmt.Errorf("failed to update JivaVolume, err: %v", err)
+// patchJivaVolume applies the mutate func on the latest JivaVolume and
+// patches the spec and metadata, the patch is retried with the mutate
+// func reapplied on conflict. The status of cr is not written, it is
+// kept as it is while the rest of cr is updated with the patched object.
+func (r *JivaVolumeReconciler) patchJivaVolume(cr *openebsiov1alpha1.JivaVolume,
+	mutate func(*openebsiov1alpha1.JivaVolume)) error {
+	instance := &openebsiov1alpha1.JivaVolume{}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := r.Get(context.TODO(),
+			types.NamespacedName{
+				Name:      cr.Name,
+				Namespace: cr.Namespace,
+			}, instance); err != nil {
+			return err
+		}
+		orig := instance.DeepCopy()
+		mutate(instance)
+		return r.Patch(context.TODO(), instance,
+			client.MergeFromWithOptions(orig, client.MergeFromWithOptimisticLock{}))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to patch JivaVolume, err: %v", err)
 	}
-	if err := r.getJivaVolume(cr); err != nil {
-		return fmt.Errorf("failed to get JivaVolume, err: %v", err)
+
+	status := cr.Status.DeepCopy()
+	instance.DeepCopyInto(cr)
+	cr.Status = *status
+	return nil
+}
+
+// updateJivaVolumeStatus writes the status of cr through the status
+// subresource. The operator is the only writer of the status, so on
+// conflict the status is written on top of the latest JivaVolume.
+func (r *JivaVolumeReconciler) updateJivaVolumeStatus(cr *openebsiov1alpha1.JivaVolume) error {
+	instance := cr.DeepCopy()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.Status().Update(context.TODO(), instance)
+		if err == nil || !errors.IsConflict(err) {
+			return err
+		}
+		if err := r.Get(context.TODO(),
+			types.NamespacedName{
+				Name:      cr.Name,
+				Namespace: cr.Namespace,
+			}, instance); err != nil {
+			return err
+		}
+		cr.Status.DeepCopyInto(&instance.Status)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update JivaVolume status, err: %v", err)
 	}
 
+	instance.DeepCopyInto(cr)
 	return nil
 }
 
@@ -1251,7 +1845,7 @@ func (r *JivaVolumeReconciler) getJivaVolume(cr *openebsiov1alpha1.JivaVolume) e
 	}
 
 	// update cr with the latest change
-	cr = instance.DeepCopy()
+	instance.DeepCopyInto(cr)
 	return nil
 }
 
@@ -1267,12 +1861,17 @@ func (r *JivaVolumeReconciler) updateStatus(err *error, cr *openebsiov1alpha1.Ji
 	if *err != nil {
 		setdefaults(cr)
 	}
-	if err := r.updateJivaVolume(cr); err != nil {
+	if err := r.updateJivaVolumeStatus(cr); err != nil {
 		logrus.Error(err, "failed to update status")
 	}
-	if err := r.getJivaVolume(cr); err != nil {
-		logrus.Error(err, "failed to get JivaVolume")
-	}
+}
+
+// newControllerClient returns the client of the REST API of the jiva
+// controller or a replica with the timeout and retries of the operator
+func newControllerClient(addr string) *jiva.ControllerClient {
+	return jiva.NewControllerClient(addr,
+		jiva.WithTimeout(controllerReqTimeout),
+		jiva.WithRetries(controllerReqRetryCount, controllerReqRetryInterval))
 }
 
 func (r *JivaVolumeReconciler) getAndUpdateVolumeStatus(cr *openebsiov1alpha1.JivaVolume) error {
@@ -1287,37 +1886,39 @@ func (r *JivaVolumeReconciler) getAndUpdateVolumeStatus(cr *openebsiov1alpha1.Ji
 		return fmt.Errorf("failed to getAndUpdateVolumeStatus, err: %v", err)
 	}
 
-	addr := cr.Spec.ISCSISpec.TargetIP + ":9501"
-	if podIP, ok := podIPMap[cr.Name]; ok {
-		addr = podIP + ":9501"
-	}
-
+	addr := r.controllerAddress(cr)
 	if len(addr) == 0 {
 		return fmt.Errorf("failed to get volume stats: target address is empty")
 	}
 
-	cli = jiva.NewControllerClient(addr)
-	stats := &volume.Stats{}
-	err = cli.Get("/stats", stats)
+	ctx, cancel := context.WithTimeout(context.TODO(), controllerReqDeadline)
+	defer cancel()
+	cli = newControllerClient(addr)
+	stats, err := cli.GetStats(ctx)
+	if err != nil {
+		stats = &volume.Stats{}
+	}
+	setVolumeConditions(cr, stats, err)
 	if err != nil {
 		// log err only, as controller must be in container creating state
 		// don't return err as it will dump stack trace unneccesary
 		logrus.Info("failed to get volume stats ", "err", err)
-		err = r.updatePodIPMap(cr)
+		err = r.resolveTargetEndpoint(cr)
 		if err != nil {
 			logrus.Infof("failed to get controller pod ip for volume %s: %s", cr.Name, err.Error())
-			time.Sleep(1 * time.Second)
 		}
 	}
 
 	cr.Status.Status = stats.TargetStatus
 	cr.Status.ReplicaCount = len(stats.Replicas)
+	prevStatuses := cr.Status.ReplicaStatuses
 	cr.Status.ReplicaStatuses = make([]openebsiov1alpha1.ReplicaStatus, len(stats.Replicas))
 
 	for i, rep := range stats.Replicas {
 		cr.Status.ReplicaStatuses[i].Address = rep.Address
 		cr.Status.ReplicaStatuses[i].Mode = rep.Mode
 	}
+	r.updateReplicaDetails(cr, stats, prevStatuses)
 
 	if stats.TargetStatus == "RW" {
 		cr.Status.Phase = openebsiov1alpha1.JivaVolumePhaseReady
@@ -1330,58 +1931,175 @@ func (r *JivaVolumeReconciler) getAndUpdateVolumeStatus(cr *openebsiov1alpha1.Ji
 	return nil
 }
 
-func (r *JivaVolumeReconciler) reconcileVersion(cr *openebsiov1alpha1.JivaVolume) error {
+// pollStatus requeues the volume by the status poll interval of its
+// phase, unless it is already requeued for an earlier time
+func (r *JivaVolumeReconciler) pollStatus(result reconcile.Result, cr *openebsiov1alpha1.JivaVolume) reconcile.Result {
+	interval := r.statusPollInterval(cr)
+	if interval > 0 && (result.RequeueAfter == 0 || interval < result.RequeueAfter) {
+		result.RequeueAfter = interval
+	}
+	return result
+}
+
+// statusPollInterval returns the interval at which the status of the
+// volume is polled in its current phase, the intervals set in the
+// policy of the volume take precedence over the ones of the operator
+func (r *JivaVolumeReconciler) statusPollInterval(cr *openebsiov1alpha1.JivaVolume) time.Duration {
+	poll := cr.Spec.Policy.StatusPoll
+	switch cr.Status.Phase {
+	case openebsiov1alpha1.JivaVolumePhaseReady:
+		if poll != nil && poll.ReadyInterval != nil {
+			return poll.ReadyInterval.Duration
+		}
+		return r.ReadyPollInterval
+	case openebsiov1alpha1.JivaVolumePhaseSyncing, openebsiov1alpha1.JivaVolumePhaseUnkown:
+		if poll != nil && poll.SyncingInterval != nil {
+			return poll.SyncingInterval.Duration
+		}
+		return r.SyncingPollInterval
+	}
+	return 0
+}
+
+// controllerAddress returns the REST API address of the jiva controller,
+// the pod IP is preferred over the service IP when it is known
+func (r *JivaVolumeReconciler) controllerAddress(cr *openebsiov1alpha1.JivaVolume) string {
+	if podIP, ok := r.endpoints.get(types.NamespacedName{Name: cr.Name, Namespace: cr.Namespace}); ok {
+		return podIP + ":9501"
+	}
+	return cr.Spec.ISCSISpec.TargetIP + ":9501"
+}
+
+// reconcileVersion upgrades the components of the volume when the desired
+// version differs from the current one. An upgrade may take several
+// reconciles, true is returned while the upgrade is in progress.
+func (r *JivaVolumeReconciler) reconcileVersion(cr *openebsiov1alpha1.JivaVolume) (bool, error) {
 	var err error
 	// the below code uses deep copy to have the state of object just before
 	// any update call is done so that on failure the last state object can be returned
 	if cr.VersionDetails.Status.Current != cr.VersionDetails.Desired {
 		if !version.IsCurrentVersionValid(cr.VersionDetails.Status.Current) {
-			return fmt.Errorf("invalid current version %s", cr.VersionDetails.Status.Current)
+			return false, fmt.Errorf("invalid current version %s", cr.VersionDetails.Status.Current)
 		}
 		if !version.IsDesiredVersionValid(cr.VersionDetails.Desired) {
-			return fmt.Errorf("invalid desired version %s", cr.VersionDetails.Desired)
+			return false, fmt.Errorf("invalid desired version %s", cr.VersionDetails.Desired)
 		}
 		jObj := cr.DeepCopy()
 		if cr.VersionDetails.Status.State != openebsiov1alpha1.ReconcileInProgress {
-			jObj.VersionDetails.Status.SetInProgressStatus()
-			err = r.updateJivaVolume(jObj)
+			// the components are saved before they are changed
+			// so that a failed upgrade can be rolled back
+			if err := r.snapshotComponents(cr); err != nil {
+				return false, fmt.Errorf("failed to snapshot components of volume %s: %v", cr.Name, err)
+			}
+			err = r.patchJivaVolume(jObj, func(j *openebsiov1alpha1.JivaVolume) {
+				delete(j.Annotations, upgradeFailuresAnnotation)
+				delete(j.Annotations, upgradeRolledBackAnnotation)
+				j.VersionDetails.Status.SetInProgressStatus()
+			})
+			if err != nil {
+				return false, err
+			}
+			setCondition(jObj, openebsiov1alpha1.JivaVolumeConditionUpgradeInProgress,
+				metav1.ConditionTrue, "Upgrading",
+				fmt.Sprintf("upgrading from %s to %s",
+					cr.VersionDetails.Status.Current, cr.VersionDetails.Desired))
+			err = r.updateJivaVolumeStatus(jObj)
 			if err != nil {
-				return err
+				return false, err
 			}
 		}
 		// Update cr with the updated fields so that we don't get
 		// resourceVersion changed error in next steps
 		if err := r.getJivaVolume(cr); err != nil {
-			return fmt.Errorf("%s, err: %v", updateErrMsg, err)
+			return false, fmt.Errorf("%s, err: %v", updateErrMsg, err)
 		}
-		// As no other steps are required just change current version to
-		// desired version
-		path := strings.Split(jObj.VersionDetails.Status.Current, "-")[0]
 		u := &upgradeParams{
-			j:      jObj,
-			client: r.Client,
-		}
-		// Get upgrade function for corresponding path, if path does not
-		// exits then no upgrade is required and funcValue will be nil.
-		funcValue := upgradeMap[path]
-		if funcValue != nil {
-			jObj, err = funcValue(u)
-			if err != nil {
-				return err
+			j: cr,
+			r: r,
+		}
+		// the current version is already checked to be
+		// one which can be upgraded to the operator version
+		upgrade := getUpgradeFunc(cr.VersionDetails.Status.Current)
+		if upgradeFailures(cr) > 0 &&
+			time.Since(cr.VersionDetails.Status.LastUpdateTime.Time) < upgradeRetryInterval {
+			return true, nil
+		}
+		done, err := upgrade(u)
+		if err != nil {
+			return false, r.setUpgradeError(cr, err)
+		}
+		if !done {
+			// the time of the last attempt is set
+			// when the upgrade starts or fails
+			if r.UpgradeTimeout > 0 &&
+				time.Since(cr.VersionDetails.Status.LastUpdateTime.Time) > r.UpgradeTimeout {
+				return false, r.setUpgradeError(cr,
+					fmt.Errorf("upgrade did not complete within %v", r.UpgradeTimeout))
 			}
+			return true, nil
 		}
-		cr = jObj.DeepCopy()
-		jObj.VersionDetails.SetSuccessStatus()
-		err = r.updateJivaVolume(jObj)
+		jObj = cr.DeepCopy()
+		err = r.patchJivaVolume(jObj, func(j *openebsiov1alpha1.JivaVolume) {
+			delete(j.Annotations, upgradeFailuresAnnotation)
+			j.VersionDetails.SetSuccessStatus()
+		})
 		if err != nil {
-			return err
+			return false, err
+		}
+		if err := r.deleteUpgradeSnapshot(jObj); err != nil {
+			return false, err
+		}
+		setCondition(jObj, openebsiov1alpha1.JivaVolumeConditionUpgradeInProgress,
+			metav1.ConditionFalse, "UpgradeComplete",
+			fmt.Sprintf("upgraded to %s", jObj.VersionDetails.Desired))
+		err = r.updateJivaVolumeStatus(jObj)
+		if err != nil {
+			return false, err
 		}
 		// Update cr with the updated fields so that we don't get
 		// resourceVersion changed error in next steps
 		if err := r.getJivaVolume(cr); err != nil {
-			return fmt.Errorf("%s, err: %v", updateErrMsg, err)
+			return false, fmt.Errorf("%s, err: %v", updateErrMsg, err)
+		}
+		return false, nil
+	}
+	return false, nil
+}
+
+// setUpgradeError records the failure of the upgrade in the version
+// status and the conditions of the volume, the upgrade is retried on the
+// next reconcile. Once the upgrade has failed MaxUpgradeFailures times
+// the components are rolled back to the current version of the volume
+// and nil is returned, otherwise the upgrade error is returned.
+func (r *JivaVolumeReconciler) setUpgradeError(cr *openebsiov1alpha1.JivaVolume, upgradeErr error) error {
+	msg := fmt.Sprintf("failed to upgrade from %s to %s",
+		cr.VersionDetails.Status.Current, cr.VersionDetails.Desired)
+	logrus.Errorf("%s for volume %s: %s", msg, cr.Name, upgradeErr.Error())
+	r.Recorder.Eventf(cr, corev1.EventTypeWarning, "Upgrade", "%s: %v", msg, upgradeErr)
+	failures := upgradeFailures(cr) + 1
+	err := r.patchJivaVolume(cr, func(j *openebsiov1alpha1.JivaVolume) {
+		if j.Annotations == nil {
+			j.Annotations = map[string]string{}
+		}
+		j.Annotations[upgradeFailuresAnnotation] = strconv.Itoa(failures)
+		j.VersionDetails.Status.SetErrorStatus(msg, upgradeErr)
+	})
+	if err != nil {
+		return err
+	}
+
+	if r.MaxUpgradeFailures > 0 && failures >= r.MaxUpgradeFailures {
+		if err := r.rollbackUpgrade(cr, upgradeErr); err != nil {
+			return fmt.Errorf("failed to rollback upgrade of volume %s: %v, upgrade err: %v",
+				cr.Name, err, upgradeErr)
 		}
 		return nil
 	}
-	return nil
+	setCondition(cr, openebsiov1alpha1.JivaVolumeConditionUpgradeInProgress,
+		metav1.ConditionTrue, "UpgradeFailed",
+		fmt.Sprintf("%s, attempt %d: %v", msg, failures, upgradeErr))
+	if err := r.updateJivaVolumeStatus(cr); err != nil {
+		return err
+	}
+	return upgradeErr
 }
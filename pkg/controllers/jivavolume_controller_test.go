@@ -0,0 +1,476 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+func TestPollStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		phase  openebsiov1alpha1.JivaVolumePhase
+		poll   *openebsiov1alpha1.StatusPollSpec
+		result reconcile.Result
+		want   time.Duration
+	}{
+		{
+			name:  "ready volume",
+			phase: openebsiov1alpha1.JivaVolumePhaseReady,
+			want:  30 * time.Second,
+		},
+		{
+			name:  "syncing volume",
+			phase: openebsiov1alpha1.JivaVolumePhaseSyncing,
+			want:  5 * time.Second,
+		},
+		{
+			name:  "unknown volume",
+			phase: openebsiov1alpha1.JivaVolumePhaseUnkown,
+			want:  5 * time.Second,
+		},
+		{
+			name:  "ready volume with policy interval",
+			phase: openebsiov1alpha1.JivaVolumePhaseReady,
+			poll: &openebsiov1alpha1.StatusPollSpec{
+				ReadyInterval: &metav1.Duration{Duration: time.Minute},
+			},
+			want: time.Minute,
+		},
+		{
+			name:  "syncing volume with policy interval",
+			phase: openebsiov1alpha1.JivaVolumePhaseSyncing,
+			poll: &openebsiov1alpha1.StatusPollSpec{
+				ReadyInterval:   &metav1.Duration{Duration: time.Minute},
+				SyncingInterval: &metav1.Duration{Duration: 2 * time.Second},
+			},
+			want: 2 * time.Second,
+		},
+		{
+			name:   "earlier requeue is kept",
+			phase:  openebsiov1alpha1.JivaVolumePhaseReady,
+			result: reconcile.Result{RequeueAfter: 10 * time.Second},
+			want:   10 * time.Second,
+		},
+		{
+			name:   "later requeue is shortened",
+			phase:  openebsiov1alpha1.JivaVolumePhaseSyncing,
+			result: reconcile.Result{RequeueAfter: 10 * time.Second},
+			want:   5 * time.Second,
+		},
+		{
+			name:  "pending volume is not polled",
+			phase: openebsiov1alpha1.JivaVolumePhasePending,
+			want:  0,
+		},
+	}
+	r := &JivaVolumeReconciler{
+		SyncingPollInterval: 5 * time.Second,
+		ReadyPollInterval:   30 * time.Second,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &openebsiov1alpha1.JivaVolume{}
+			cr.Status.Phase = tt.phase
+			cr.Spec.Policy.StatusPoll = tt.poll
+			got := r.pollStatus(tt.result, cr)
+			if got.RequeueAfter != tt.want {
+				t.Errorf("RequeueAfter = %v, want %v", got.RequeueAfter, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectScaledown(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := openebsiov1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		rf           int
+		desired      int
+		wantRejected bool
+	}{
+		{name: "scaledown keeping the qurom", rf: 3, desired: 2},
+		{name: "scaledown breaking the qurom", rf: 3, desired: 1, wantRejected: true},
+		{name: "scaledown of two replicas", rf: 2, desired: 1, wantRejected: true},
+		{name: "scaleup", rf: 1, desired: 3},
+		{name: "no change", rf: 3, desired: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &openebsiov1alpha1.JivaVolume{}
+			cr.Name = "pvc-1"
+			cr.Namespace = "openebs"
+			cr.Spec.Policy.Target.ReplicationFactor = tt.rf
+			cr.Spec.DesiredReplicationFactor = tt.desired
+			r := &JivaVolumeReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(s).WithObjects(cr.DeepCopy()).Build(),
+				Scheme:   s,
+				Recorder: record.NewFakeRecorder(10),
+			}
+
+			rejected, err := r.rejectScaledown(cr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rejected != tt.wantRejected {
+				t.Fatalf("rejectScaledown() = %v, want %v", rejected, tt.wantRejected)
+			}
+
+			got := &openebsiov1alpha1.JivaVolume{}
+			if err := r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1", Namespace: "openebs"}, got); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantRejected {
+				if got.Spec.DesiredReplicationFactor != tt.desired {
+					t.Errorf("desired replication factor = %d, want %d", got.Spec.DesiredReplicationFactor, tt.desired)
+				}
+				return
+			}
+			if got.Spec.DesiredReplicationFactor != tt.rf {
+				t.Errorf("desired replication factor = %d, want %d", got.Spec.DesiredReplicationFactor, tt.rf)
+			}
+			cond := meta.FindStatusCondition(got.Status.Conditions,
+				openebsiov1alpha1.JivaVolumeConditionScalingInProgress)
+			if cond == nil || cond.Reason != scaledownRejectedReason {
+				t.Errorf("condition = %v, want reason %s", cond, scaledownRejectedReason)
+			}
+
+			// the refusal is kept while the replicas are polled
+			setScalingCondition(got, true)
+			if !isScaledownRejected(got) {
+				t.Errorf("scaledown refusal is not kept in the condition")
+			}
+		})
+	}
+}
+
+func TestScaleup(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := openebsiov1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	cr := &openebsiov1alpha1.JivaVolume{}
+	cr.Name = "pvc-1"
+	cr.Namespace = "openebs"
+	cr.Spec.Policy.Target.ReplicationFactor = 1
+	cr.Spec.DesiredReplicationFactor = 3
+	cr.Status.Phase = openebsiov1alpha1.JivaVolumePhaseReady
+
+	reps := int32(1)
+	sts := &appsv1.StatefulSet{}
+	sts.Name = "pvc-1-jiva-rep"
+	sts.Namespace = "openebs"
+	sts.Spec.Replicas = &reps
+
+	ctrl := &appsv1.Deployment{}
+	ctrl.Name = "pvc-1-jiva-ctrl"
+	ctrl.Namespace = "openebs"
+	ctrl.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "jiva-controller",
+		Env:  []corev1.EnvVar{{Name: "REPLICATION_FACTOR", Value: "1"}},
+	}}
+
+	recorder := record.NewFakeRecorder(20)
+	r := &JivaVolumeReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(s).WithObjects(cr.DeepCopy(), sts, ctrl).Build(),
+		Scheme:   s,
+		Recorder: recorder,
+	}
+
+	// setReplicas sets the replicas registered with the jiva controller
+	// in the status, as polled from the controller by the reconciler
+	setReplicas := func(count int, mode string) {
+		cr.Status.ReplicaCount = count
+		cr.Status.ReplicaStatuses = nil
+		for i := 0; i < count; i++ {
+			cr.Status.ReplicaStatuses = append(cr.Status.ReplicaStatuses,
+				openebsiov1alpha1.ReplicaStatus{Mode: mode})
+		}
+	}
+	// assertStep checks the replica count of the step in the policy,
+	// the replica statefulset and the jiva controller envs
+	assertStep := func(rf int) {
+		t.Helper()
+		got := &openebsiov1alpha1.JivaVolume{}
+		if err := r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1", Namespace: "openebs"}, got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Spec.Policy.Target.ReplicationFactor != rf {
+			t.Errorf("replication factor = %d, want %d", got.Spec.Policy.Target.ReplicationFactor, rf)
+		}
+		if got.Status.Scaleup == nil || got.Status.Scaleup.InitialReplicationFactor != 1 ||
+			got.Status.Scaleup.ReplicationFactor != rf {
+			t.Errorf("scaleup status = %+v, want step %d from 1", got.Status.Scaleup, rf)
+		}
+		gotSTS := &appsv1.StatefulSet{}
+		if err := r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1-jiva-rep", Namespace: "openebs"}, gotSTS); err != nil {
+			t.Fatal(err)
+		}
+		if *gotSTS.Spec.Replicas != int32(rf) {
+			t.Errorf("statefulset replicas = %d, want %d", *gotSTS.Spec.Replicas, rf)
+		}
+		gotCtrl := &appsv1.Deployment{}
+		if err := r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1-jiva-ctrl", Namespace: "openebs"}, gotCtrl); err != nil {
+			t.Fatal(err)
+		}
+		if env := gotCtrl.Spec.Template.Spec.Containers[0].Env[0].Value; env != strconv.Itoa(rf) {
+			t.Errorf("controller REPLICATION_FACTOR = %s, want %d", env, rf)
+		}
+	}
+	scaleup := func() {
+		t.Helper()
+		if !r.isScaleup(cr) {
+			t.Fatalf("isScaleup() = false, want true")
+		}
+		if err := r.performScaleup(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setReplicas(1, "RW")
+	scaleup()
+	assertStep(2)
+
+	// the next step waits for the added replica to be registered
+	// and for all the replicas to be in RW mode
+	if r.isScaleup(cr) {
+		t.Errorf("isScaleup() = true while the added replica is not registered")
+	}
+	setReplicas(2, "WO")
+	if r.isScaleup(cr) {
+		t.Errorf("isScaleup() = true while the added replica is rebuilding")
+	}
+	setReplicas(2, "RW")
+	scaleup()
+	assertStep(3)
+
+	// the scaleup is completed once all the replicas are in RW mode
+	setReplicas(3, "RW")
+	if err := r.completeScaleup(cr); err != nil {
+		t.Fatal(err)
+	}
+	if cr.Status.Scaleup != nil || r.isScaleup(cr) {
+		t.Errorf("scaleup status = %+v, want the scaleup completed", cr.Status.Scaleup)
+	}
+	close(recorder.Events)
+	for event := range recorder.Events {
+		if strings.HasPrefix(event, corev1.EventTypeWarning) {
+			t.Errorf("unexpected event: %s", event)
+		}
+	}
+}
+
+func TestScaleupResume(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := openebsiov1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// the step to 3 replicas is recorded in the status, but the
+	// operator restarted before it was applied to the policy
+	cr := &openebsiov1alpha1.JivaVolume{}
+	cr.Name = "pvc-1"
+	cr.Namespace = "openebs"
+	cr.Spec.Policy.Target.ReplicationFactor = 2
+	cr.Spec.DesiredReplicationFactor = 3
+	cr.Status.Phase = openebsiov1alpha1.JivaVolumePhaseReady
+	cr.Status.ReplicaCount = 3
+	cr.Status.Scaleup = &openebsiov1alpha1.ScaleupStatus{
+		InitialReplicationFactor: 1,
+		DesiredReplicationFactor: 3,
+		ReplicationFactor:        3,
+	}
+
+	reps := int32(3)
+	sts := &appsv1.StatefulSet{}
+	sts.Name = "pvc-1-jiva-rep"
+	sts.Namespace = "openebs"
+	sts.Spec.Replicas = &reps
+
+	ctrl := &appsv1.Deployment{}
+	ctrl.Name = "pvc-1-jiva-ctrl"
+	ctrl.Namespace = "openebs"
+
+	r := &JivaVolumeReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(s).WithObjects(cr.DeepCopy(), sts, ctrl).Build(),
+		Scheme:   s,
+		Recorder: record.NewFakeRecorder(10),
+	}
+
+	if !r.isScaleup(cr) {
+		t.Fatalf("isScaleup() = false, want the interrupted step resumed")
+	}
+	if err := r.performScaleup(cr); err != nil {
+		t.Fatal(err)
+	}
+	got := &openebsiov1alpha1.JivaVolume{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1", Namespace: "openebs"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Spec.Policy.Target.ReplicationFactor != 3 {
+		t.Errorf("replication factor = %d, want 3", got.Spec.Policy.Target.ReplicationFactor)
+	}
+	if got.Status.Scaleup == nil || got.Status.Scaleup.InitialReplicationFactor != 1 {
+		t.Errorf("scaleup status = %+v, want the initial replication factor kept", got.Status.Scaleup)
+	}
+}
+
+func TestCreateReplicaStatefulSetClone(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := openebsiov1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	prevServiceAccount := defaultServiceAccountName
+	t.Cleanup(func() { defaultServiceAccountName = prevServiceAccount })
+	defaultServiceAccountName = "openebs-jiva-operator"
+
+	source := func(phase openebsiov1alpha1.JivaVolumePhase, targetIP string) *openebsiov1alpha1.JivaVolume {
+		src := &openebsiov1alpha1.JivaVolume{}
+		src.Name = "pvc-src"
+		src.Namespace = "openebs"
+		src.Spec.ISCSISpec.TargetIP = targetIP
+		src.Status.Phase = phase
+		return src
+	}
+	tests := []struct {
+		name     string
+		src      *openebsiov1alpha1.VolumeSource
+		source   *openebsiov1alpha1.JivaVolume
+		wantArgs []string
+		wantErr  bool
+	}{
+		{
+			name:     "volume is not a clone",
+			wantArgs: []string{"replica", "--frontendIP", "10.0.0.1", "--size", "1073741824", "openebs"},
+		},
+		{
+			name:   "clone syncs from the source target",
+			src:    &openebsiov1alpha1.VolumeSource{SourceVolume: "pvc-src", Snapshot: "clone-pvc-1"},
+			source: source(openebsiov1alpha1.JivaVolumePhaseReady, "10.0.0.2"),
+			wantArgs: []string{"replica", "--frontendIP", "10.0.0.1", "--size", "1073741824",
+				"--type", "clone", "--cloneIP", "10.0.0.2", "--snapName", "clone-pvc-1", "openebs"},
+		},
+		{
+			name:    "source volume is not ready",
+			src:     &openebsiov1alpha1.VolumeSource{SourceVolume: "pvc-src", Snapshot: "clone-pvc-1"},
+			source:  source(openebsiov1alpha1.JivaVolumePhaseSyncing, "10.0.0.2"),
+			wantErr: true,
+		},
+		{
+			name:    "source volume has no target",
+			src:     &openebsiov1alpha1.VolumeSource{SourceVolume: "pvc-src", Snapshot: "clone-pvc-1"},
+			source:  source(openebsiov1alpha1.JivaVolumePhaseReady, ""),
+			wantErr: true,
+		},
+		{
+			name:    "source volume is missing",
+			src:     &openebsiov1alpha1.VolumeSource{SourceVolume: "pvc-src", Snapshot: "clone-pvc-1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &openebsiov1alpha1.JivaVolume{}
+			cr.Name = "pvc-1"
+			cr.Namespace = "openebs"
+			cr.Spec.PV = "pvc-1"
+			cr.Spec.Capacity = "1Gi"
+			cr.Spec.Policy = getDefaultPolicySpec()
+			cr.Spec.VolumeSource = tt.src
+			svc := &corev1.Service{}
+			svc.Name = "pvc-1-jiva-ctrl-svc"
+			svc.Namespace = "openebs"
+			svc.Spec.ClusterIP = "10.0.0.1"
+			objs := []client.Object{cr.DeepCopy(), svc}
+			if tt.source != nil {
+				objs = append(objs, tt.source)
+			}
+			r := &JivaVolumeReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build(),
+				Scheme:   s,
+				Recorder: record.NewFakeRecorder(10),
+			}
+
+			err := createReplicaStatefulSet(r, cr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createReplicaStatefulSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			replicaSTS := &appsv1.StatefulSet{}
+			err = r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1-jiva-rep", Namespace: "openebs"}, replicaSTS)
+			if tt.wantErr {
+				if !errors.IsNotFound(err) {
+					t.Errorf("statefulset should not be created, got err %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if args := replicaSTS.Spec.Template.Spec.Containers[0].Args; !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("replica args = %v, want %v", args, tt.wantArgs)
+			}
+
+			// the rollouts build the statefulset without the source
+			built, err := r.buildReplicaStatefulSet(cr, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := append(append([]string{}, tt.wantArgs[:5]...), "openebs")
+			if args := built.Spec.Template.Spec.Containers[0].Args; !reflect.DeepEqual(args, want) {
+				t.Errorf("rollout replica args = %v, want %v", args, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	operr "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/jiva-operator/pkg/webhook"
+)
+
+// invalidPolicyRequeueInterval is the interval after which an invalid
+// policy is validated again, as it may refer to a storage class which
+// is yet to be created
+const invalidPolicyRequeueInterval = time.Minute
+
+// JivaVolumePolicyReconciler propagates the changes in a JivaVolumePolicy
+// to the policy of the JivaVolumes using it. The JivaVolume controller
+// then rolls the changes out to the target and the replicas.
+type JivaVolumePolicyReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=openebs.io.openebs.io,resources=jivavolumepolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=openebs.io.openebs.io,resources=jivavolumepolicies/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=openebs.io.openebs.io,resources=jivavolumes,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+
+// Reconcile validates the JivaVolumePolicy and updates the policy
+// of the JivaVolumes annotated with the name of the JivaVolumePolicy
+func (r *JivaVolumePolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	policy := &openebsiov1alpha1.JivaVolumePolicy{}
+	err := r.Get(context.TODO(), req.NamespacedName, policy)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// the volumes keep the copy of the deleted policy
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	validationErr := webhook.ValidateJivaVolumePolicy(context.TODO(), r.Client, policy)
+	if err := r.updatePolicyStatus(policy, validationErr); err != nil {
+		return reconcile.Result{}, err
+	}
+	if validationErr != nil {
+		logrus.Errorf("invalid volume policy %s: %s", policy.Name, validationErr.Error())
+		return reconcile.Result{RequeueAfter: invalidPolicyRequeueInterval}, nil
+	}
+
+	policySpec := policy.Spec
+	validatePolicySpec(&policySpec)
+
+	volumes := openebsiov1alpha1.JivaVolumeList{}
+	err = r.List(context.TODO(), &volumes, client.InNamespace(policy.Namespace))
+	if err != nil {
+		return reconcile.Result{}, operr.Wrapf(err, "failed to list volumes of policy %s", policy.Name)
+	}
+	for i := range volumes.Items {
+		cr := &volumes.Items[i]
+		if cr.Annotations["openebs.io/volume-policy"] != policy.Name ||
+			cr.DeletionTimestamp != nil {
+			continue
+		}
+		// the policy is populated in the volume while bootstrapping
+		if cr.Status.Phase == "" || cr.Status.Phase == openebsiov1alpha1.JivaVolumePhasePending {
+			continue
+		}
+		updated, err := r.updateVolumePolicy(cr, policySpec)
+		if err != nil {
+			return reconcile.Result{}, operr.Wrapf(err, "failed to update policy of volume %s", cr.Name)
+		}
+		if updated {
+			logrus.Infof("updated volume %s with the changes in policy %s", cr.Name, policy.Name)
+			r.Recorder.Eventf(cr, corev1.EventTypeNormal, "PolicyUpdate",
+				"policy updated from JivaVolumePolicy %s", policy.Name)
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+// updatePolicyStatus sets the phase of the policy to Invalid with the
+// validation error as the message, or to Valid if there is no error
+func (r *JivaVolumePolicyReconciler) updatePolicyStatus(policy *openebsiov1alpha1.JivaVolumePolicy,
+	validationErr error) error {
+	status := openebsiov1alpha1.JivaVolumePolicyStatus{
+		Phase: openebsiov1alpha1.JivaVolumePolicyPhaseValid,
+	}
+	if validationErr != nil {
+		status.Phase = openebsiov1alpha1.JivaVolumePolicyPhaseInvalid
+		status.Message = validationErr.Error()
+	}
+	if policy.Status == status {
+		return nil
+	}
+	if status.Phase != policy.Status.Phase {
+		eventType := corev1.EventTypeNormal
+		if validationErr != nil {
+			eventType = corev1.EventTypeWarning
+		}
+		r.Recorder.Eventf(policy, eventType, "PolicyValidation", "policy is %s", status.Phase)
+	}
+	policy.Status = status
+	return r.Status().Update(context.TODO(), policy)
+}
+
+// updateVolumePolicy patches the policy of the volume with the fields
+// of the policy spec which can be changed on an existing volume, false
+// is returned if the policy of the volume is already up to date
+func (r *JivaVolumePolicyReconciler) updateVolumePolicy(cr *openebsiov1alpha1.JivaVolume,
+	policySpec openebsiov1alpha1.JivaVolumePolicySpec) (bool, error) {
+	updated := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		instance := &openebsiov1alpha1.JivaVolume{}
+		err := r.Get(context.TODO(),
+			types.NamespacedName{Name: cr.Name, Namespace: cr.Namespace}, instance)
+		if err != nil {
+			return err
+		}
+		newInstance := instance.DeepCopy()
+		applyPolicyUpdate(&newInstance.Spec.Policy, policySpec)
+		if equality.Semantic.DeepEqual(instance.Spec.Policy, newInstance.Spec.Policy) {
+			updated = false
+			return nil
+		}
+		updated = true
+		return r.Patch(context.TODO(), newInstance,
+			client.MergeFromWithOptions(instance, client.MergeFromWithOptimisticLock{}))
+	})
+	return updated, err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *JivaVolumePolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		// only the changes in the spec are propagated
+		For(&openebsiov1alpha1.JivaVolumePolicy{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
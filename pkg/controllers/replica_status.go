@@ -0,0 +1,151 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openebs/jiva-operator/pkg/jiva"
+	"github.com/openebs/jiva-operator/pkg/volume"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+// replicaDetailsInterval is the interval at which the details of
+// the replicas are refreshed, so that the replica REST API is not
+// called on every reconcile
+const replicaDetailsInterval = 10 * time.Second
+
+// updateReplicaDetails fills the pod, node and pvc of the replicas
+// from the replica pods, and the revision counter and rebuild progress
+// from the replica REST API. The replicas connected to the controller
+// are marked as seen on every poll, but only the ones which are new,
+// have changed their mode or whose details were refreshed over
+// replicaDetailsInterval ago are refreshed. Failure in fetching the
+// details of a replica is only logged, as the replica may be restarting.
+func (r *JivaVolumeReconciler) updateReplicaDetails(cr *openebsiov1alpha1.JivaVolume,
+	stats *volume.Stats, prev []openebsiov1alpha1.ReplicaStatus) {
+	prevByAddr := map[string]openebsiov1alpha1.ReplicaStatus{}
+	for _, rep := range prev {
+		prevByAddr[rep.Address] = rep
+	}
+	now := metav1.Now()
+	var stale []*openebsiov1alpha1.ReplicaStatus
+	for i := range cr.Status.ReplicaStatuses {
+		rep := &cr.Status.ReplicaStatuses[i]
+		p, ok := prevByAddr[rep.Address]
+		if !ok || p.Mode != rep.Mode || p.DetailsUpdateTime == nil ||
+			now.Sub(p.DetailsUpdateTime.Time) >= replicaDetailsInterval {
+			rep.LastSeenTime = &now
+			stale = append(stale, rep)
+			continue
+		}
+		p.DeepCopyInto(rep)
+		rep.LastSeenTime = &now
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	labelSelector, err := labels.Parse(
+		"openebs.io/component=jiva-replica,openebs.io/persistent-volume=" + cr.Name)
+	if err != nil {
+		logrus.Errorf("failed to parse replica label selector: %s", err.Error())
+		return
+	}
+	pods := corev1.PodList{}
+	err = r.List(context.TODO(), &pods, &client.ListOptions{
+		Namespace:     cr.Namespace,
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		logrus.Errorf("failed to list replica pods for volume %s: %s", cr.Name, err.Error())
+	}
+	podByIP := map[string]*corev1.Pod{}
+	for i := range pods.Items {
+		if pods.Items[i].Status.PodIP != "" {
+			podByIP[pods.Items[i].Status.PodIP] = &pods.Items[i]
+		}
+	}
+
+	for _, rep := range stale {
+		rep.DetailsUpdateTime = &now
+
+		addr := jiva.ReplicaAddress(rep.Address)
+		if pod, ok := podByIP[strings.Split(addr, ":")[0]]; ok {
+			rep.PodName = pod.Name
+			rep.NodeName = pod.Spec.NodeName
+			for _, vol := range pod.Spec.Volumes {
+				if vol.PersistentVolumeClaim != nil {
+					rep.PVC = vol.PersistentVolumeClaim.ClaimName
+				}
+			}
+		}
+
+		updateReplicaProgress(rep, addr, stats)
+	}
+}
+
+// updateReplicaProgress fills the revision counter and the rebuild
+// progress of the replica from the replica REST API
+func updateReplicaProgress(rep *openebsiov1alpha1.ReplicaStatus, addr string, stats *volume.Stats) {
+	ctx, cancel := context.WithTimeout(context.TODO(), controllerReqDeadline)
+	defer cancel()
+	cli := newControllerClient(addr)
+	info, err := cli.GetReplica(ctx)
+	if err != nil {
+		logrus.Infof("failed to get details of replica %s: %s", rep.Address, err.Error())
+		return
+	}
+	rep.RevisionCounter, _ = strconv.ParseInt(info.RevisionCounter, 10, 64)
+
+	if rep.Mode == "RW" {
+		rep.RebuildProgress = 100
+		return
+	}
+	usage, err := cli.GetVolUsage(ctx)
+	if err != nil {
+		logrus.Infof("failed to get volume usage of replica %s: %s", rep.Address, err.Error())
+		return
+	}
+	rep.RebuildProgress = rebuildProgress(usage.UsedLogicalBlocks, stats.UsedLogicalBlocks.String())
+}
+
+// rebuildProgress estimates the percentage of the data synced to a
+// replica from the blocks used by the replica and by the volume
+func rebuildProgress(replicaBlocks, volumeBlocks string) int {
+	used, err := strconv.ParseInt(replicaBlocks, 10, 64)
+	if err != nil {
+		return 0
+	}
+	total, err := strconv.ParseInt(volumeBlocks, 10, 64)
+	if err != nil || total <= 0 {
+		return 0
+	}
+	if used >= total {
+		return 100
+	}
+	return int(used * 100 / total)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/jiva-operator/pkg/volume"
+)
+
+func TestRebuildProgress(t *testing.T) {
+	tests := []struct {
+		name          string
+		replicaBlocks string
+		volumeBlocks  string
+		want          int
+	}{
+		{name: "partially synced", replicaBlocks: "250", volumeBlocks: "1000", want: 25},
+		{name: "fully synced", replicaBlocks: "1000", volumeBlocks: "1000", want: 100},
+		{name: "more blocks than volume", replicaBlocks: "1200", volumeBlocks: "1000", want: 100},
+		{name: "empty volume", replicaBlocks: "0", volumeBlocks: "0", want: 0},
+		{name: "invalid replica blocks", replicaBlocks: "", volumeBlocks: "1000", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rebuildProgress(tt.replicaBlocks, tt.volumeBlocks); got != tt.want {
+				t.Errorf("rebuildProgress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateReplicaDetails(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	r := &JivaVolumeReconciler{
+		Client: fake.NewClientBuilder().WithScheme(s).Build(),
+		Scheme: s,
+	}
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		fmt.Fprint(w, `{"revisioncounter": "7"}`)
+	}))
+	defer srv.Close()
+	addr := "tcp://" + strings.TrimPrefix(srv.URL, "http://")
+
+	lastSeen := metav1.NewTime(time.Now().Add(-time.Hour))
+	tests := []struct {
+		name         string
+		detailsAge   time.Duration
+		wantRefresh  bool
+		wantRevision int64
+	}{
+		{name: "fresh details are kept", detailsAge: time.Second, wantRevision: 3},
+		{name: "stale details are refreshed", detailsAge: replicaDetailsInterval, wantRefresh: true, wantRevision: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			updated := metav1.NewTime(time.Now().Add(-tt.detailsAge))
+			prev := []openebsiov1alpha1.ReplicaStatus{{
+				Address:           addr,
+				Mode:              "RW",
+				PodName:           "pvc-1-jiva-rep-0",
+				RevisionCounter:   3,
+				LastSeenTime:      &lastSeen,
+				DetailsUpdateTime: &updated,
+			}}
+			cr := &openebsiov1alpha1.JivaVolume{}
+			cr.Name = "pvc-1"
+			cr.Namespace = "openebs"
+			cr.Status.ReplicaStatuses = []openebsiov1alpha1.ReplicaStatus{{Address: addr, Mode: "RW"}}
+
+			start := time.Now()
+			r.updateReplicaDetails(cr, &volume.Stats{}, prev)
+			rep := cr.Status.ReplicaStatuses[0]
+			if rep.LastSeenTime == nil || rep.LastSeenTime.Time.Before(start.Truncate(time.Second)) {
+				t.Errorf("LastSeenTime = %v, want the time of the poll", rep.LastSeenTime)
+			}
+			if (calls > 0) != tt.wantRefresh {
+				t.Errorf("replica API called %d times, want refresh %v", calls, tt.wantRefresh)
+			}
+			if rep.RevisionCounter != tt.wantRevision {
+				t.Errorf("RevisionCounter = %d, want %d", rep.RevisionCounter, tt.wantRevision)
+			}
+			if !tt.wantRefresh && (rep.PodName != "pvc-1-jiva-rep-0" || !rep.DetailsUpdateTime.Equal(&updated)) {
+				t.Errorf("details = %+v, want the previous details kept", rep)
+			}
+			if tt.wantRefresh && !rep.DetailsUpdateTime.Equal(rep.LastSeenTime) {
+				t.Errorf("DetailsUpdateTime = %v, want the time of the poll", rep.DetailsUpdateTime)
+			}
+		})
+	}
+}
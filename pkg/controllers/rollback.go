@@ -0,0 +1,321 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/openebs/jiva-operator/pkg/jiva"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+const (
+	// upgradeFailuresAnnotation counts the failed attempts
+	// of the upgrade which is in progress
+	upgradeFailuresAnnotation = "openebs.io/upgrade-failures"
+	// upgradeRolledBackAnnotation is set to the version an upgrade
+	// was rolled back from, it is removed once an upgrade is retried
+	upgradeRolledBackAnnotation = "openebs.io/upgrade-rolled-back"
+
+	snapshotVersionKey  = "version"
+	snapshotServiceKey  = "target-service"
+	snapshotTargetKey   = "target-deployment"
+	snapshotReplicasKey = "replica-statefulset"
+)
+
+// componentSnapshot is the part of a component which is changed by the
+// upgrade, it is restored as is when the upgrade is rolled back
+type componentSnapshot struct {
+	Labels   map[string]string       `json:"labels,omitempty"`
+	Template *corev1.PodTemplateSpec `json:"template,omitempty"`
+	Ports    []corev1.ServicePort    `json:"ports,omitempty"`
+}
+
+func upgradeSnapshotName(cr *openebsiov1alpha1.JivaVolume) string {
+	return cr.Name + "-jiva-upgrade-snapshot"
+}
+
+// upgradeFailures returns the number of failed attempts of the upgrade
+func upgradeFailures(cr *openebsiov1alpha1.JivaVolume) int {
+	failures, err := strconv.Atoi(cr.Annotations[upgradeFailuresAnnotation])
+	if err != nil {
+		return 0
+	}
+	return failures
+}
+
+// isRolledBack returns true if the last upgrade of the volume was rolled
+// back and no other upgrade has been requested since
+func isRolledBack(cr *openebsiov1alpha1.JivaVolume) bool {
+	_, ok := cr.Annotations[upgradeRolledBackAnnotation]
+	return ok && cr.VersionDetails.Desired == cr.VersionDetails.Status.Current
+}
+
+// snapshotComponents saves the labels, the pod templates and the service
+// ports of the components of the volume in a ConfigMap owned by the volume, before
+// they are changed by the upgrade. The components which are not yet
+// created are left out.
+func (r *JivaVolumeReconciler) snapshotComponents(cr *openebsiov1alpha1.JivaVolume) error {
+	data := map[string]string{
+		snapshotVersionKey: cr.VersionDetails.Status.Current,
+	}
+	add := func(key string, obj client.Object, template *corev1.PodTemplateSpec,
+		ports *[]corev1.ServicePort) error {
+		err := r.Get(context.TODO(), types.NamespacedName{Name: obj.GetName(), Namespace: cr.Namespace}, obj)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		snapshot := componentSnapshot{Labels: obj.GetLabels(), Template: template}
+		if ports != nil {
+			snapshot.Ports = *ports
+		}
+		raw, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		data[key] = string(raw)
+		return nil
+	}
+
+	ctrlSVC := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: cr.Name + "-jiva-ctrl-svc"}}
+	if err := add(snapshotServiceKey, ctrlSVC, nil, &ctrlSVC.Spec.Ports); err != nil {
+		return err
+	}
+	ctrlDeploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: cr.Name + "-jiva-ctrl"}}
+	if err := add(snapshotTargetKey, ctrlDeploy, &ctrlDeploy.Spec.Template, nil); err != nil {
+		return err
+	}
+	replicaSTS := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: cr.Name + "-jiva-rep"}}
+	if err := add(snapshotReplicasKey, replicaSTS, &replicaSTS.Spec.Template, nil); err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upgradeSnapshotName(cr),
+			Namespace: cr.Namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(context.TODO(), r.Client, cm, func() error {
+		cm.Labels = map[string]string{"openebs.io/persistent-volume": cr.Name}
+		cm.Data = data
+		return controllerutil.SetControllerReference(cr, cm, r.Scheme)
+	})
+	return err
+}
+
+// deleteUpgradeSnapshot removes the snapshot of the components once the
+// upgrade is completed or rolled back
+func (r *JivaVolumeReconciler) deleteUpgradeSnapshot(cr *openebsiov1alpha1.JivaVolume) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upgradeSnapshotName(cr),
+			Namespace: cr.Namespace,
+		},
+	}
+	if err := r.Delete(context.TODO(), cm); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// rollbackUpgrade restores the components of the volume from the snapshot
+// taken before the upgrade, and sets the desired version of the volume
+// back to its current version so that the upgrade is not retried.
+func (r *JivaVolumeReconciler) rollbackUpgrade(cr *openebsiov1alpha1.JivaVolume, upgradeErr error) error {
+	cm := &corev1.ConfigMap{}
+	err := r.Get(context.TODO(),
+		types.NamespacedName{Name: upgradeSnapshotName(cr), Namespace: cr.Namespace}, cm)
+	if err != nil {
+		return fmt.Errorf("failed to get upgrade snapshot of volume %s: %v", cr.Name, err)
+	}
+	if cm.Data[snapshotVersionKey] != cr.VersionDetails.Status.Current {
+		return fmt.Errorf("upgrade snapshot of volume %s is of version %s, not %s",
+			cr.Name, cm.Data[snapshotVersionKey], cr.VersionDetails.Status.Current)
+	}
+
+	if err := r.restoreComponent(cm, snapshotServiceKey,
+		&corev1.Service{}, cr.Name+"-jiva-ctrl-svc", cr.Namespace); err != nil {
+		return err
+	}
+	if err := r.restoreComponent(cm, snapshotReplicasKey,
+		&appsv1.StatefulSet{}, cr.Name+"-jiva-rep", cr.Namespace); err != nil {
+		return err
+	}
+	if err := r.restoreComponent(cm, snapshotTargetKey,
+		&appsv1.Deployment{}, cr.Name+"-jiva-ctrl", cr.Namespace); err != nil {
+		return err
+	}
+
+	from := cr.VersionDetails.Desired
+	current := cr.VersionDetails.Status.Current
+	msg := fmt.Sprintf("rolled back to %s after %d failed attempts to upgrade to %s",
+		current, upgradeFailures(cr), from)
+	logrus.Errorf("%s for volume %s: %s", msg, cr.Name, upgradeErr.Error())
+	r.Recorder.Eventf(cr, corev1.EventTypeWarning, "UpgradeRollback", "%s: %v", msg, upgradeErr)
+
+	err = r.patchJivaVolume(cr, func(j *openebsiov1alpha1.JivaVolume) {
+		delete(j.Annotations, upgradeFailuresAnnotation)
+		if j.Annotations == nil {
+			j.Annotations = map[string]string{}
+		}
+		j.Annotations[upgradeRolledBackAnnotation] = from
+		j.VersionDetails.Desired = current
+		j.VersionDetails.Status.SetErrorStatus(msg, upgradeErr)
+		j.VersionDetails.Status.State = openebsiov1alpha1.ReconcileComplete
+	})
+	if err != nil {
+		return err
+	}
+	setCondition(cr, openebsiov1alpha1.JivaVolumeConditionUpgradeInProgress,
+		metav1.ConditionFalse, "UpgradeRolledBack", fmt.Sprintf("%s: %v", msg, upgradeErr))
+	if err := r.updateJivaVolumeStatus(cr); err != nil {
+		return err
+	}
+	return r.deleteUpgradeSnapshot(cr)
+}
+
+// restoreComponent patches the labels, the pod template and the service
+// ports of the named component with the ones saved in the snapshot. The replicas are restored
+// one at a time by restoreReplicas, starting from the last replica.
+func (r *JivaVolumeReconciler) restoreComponent(cm *corev1.ConfigMap, key string,
+	obj client.Object, name, namespace string) error {
+	raw, ok := cm.Data[key]
+	if !ok {
+		return nil
+	}
+	snapshot := componentSnapshot{}
+	if err := json.Unmarshal([]byte(raw), &snapshot); err != nil {
+		return fmt.Errorf("failed to decode %s of upgrade snapshot %s: %v", key, cm.Name, err)
+	}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, obj)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	newObj := obj.DeepCopyObject().(client.Object)
+	newObj.SetLabels(snapshot.Labels)
+	logrus.Infof("restoring %s %s from the upgrade snapshot", key, name)
+	switch o := newObj.(type) {
+	case *corev1.Service:
+		if snapshot.Ports != nil {
+			o.Spec.Ports = snapshot.Ports
+		}
+	case *appsv1.Deployment:
+		if snapshot.Template != nil {
+			o.Spec.Template = *snapshot.Template
+		}
+	case *appsv1.StatefulSet:
+		if snapshot.Template != nil {
+			o.Spec.Template = *snapshot.Template
+		}
+		return r.startReplicaRollout(obj.(*appsv1.StatefulSet), o)
+	}
+	return r.Patch(context.TODO(), newObj, client.MergeFrom(obj))
+}
+
+// restoreReplicas restarts the replicas of a rolled back volume with the
+// restored pod template, one at a time. True is returned till all the
+// replicas are restored.
+func (r *JivaVolumeReconciler) restoreReplicas(cr *openebsiov1alpha1.JivaVolume) (bool, error) {
+	if !isRolledBack(cr) {
+		return false, nil
+	}
+	replicaSTS := &appsv1.StatefulSet{}
+	err := r.Get(context.TODO(),
+		types.NamespacedName{Name: cr.Name + "-jiva-rep", Namespace: cr.Namespace}, replicaSTS)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return r.stepReplicaRollout(cr, replicaSTS)
+}
+
+// areRestoredReplicasRW returns true if the replica pods at or above the
+// partition of the statefulset are ready with the restored pod template
+// and are registered with the target in RW mode. The replicas below the
+// partition are not checked, as they may have been left unhealthy by the
+// failed upgrade.
+func (r *JivaVolumeReconciler) areRestoredReplicasRW(cr *openebsiov1alpha1.JivaVolume,
+	replicaSTS *appsv1.StatefulSet, partition int32) (bool, error) {
+	labelSelector, err := labels.Parse(
+		"openebs.io/component=jiva-replica,openebs.io/persistent-volume=" + cr.Name)
+	if err != nil {
+		return false, err
+	}
+	pods := corev1.PodList{}
+	err = r.List(context.TODO(), &pods, &client.ListOptions{
+		Namespace:     cr.Namespace,
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		return false, err
+	}
+	rwIPs := map[string]bool{}
+	for _, rep := range cr.Status.ReplicaStatuses {
+		if rep.Mode == "RW" {
+			rwIPs[strings.Split(jiva.ReplicaAddress(rep.Address), ":")[0]] = true
+		}
+	}
+
+	restored := int32(0)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		idx := strings.LastIndex(pod.Name, "-")
+		ordinal, err := strconv.Atoi(pod.Name[idx+1:])
+		if idx < 0 || err != nil || int32(ordinal) < partition {
+			continue
+		}
+		if pod.Labels[appsv1.ControllerRevisionHashLabelKey] != replicaSTS.Status.UpdateRevision ||
+			!isPodReady(pod) || !rwIPs[pod.Status.PodIP] {
+			return false, nil
+		}
+		restored++
+	}
+	return restored >= *replicaSTS.Spec.Replicas-partition, nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+func TestRollbackUpgrade(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := openebsiov1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	cr := &openebsiov1alpha1.JivaVolume{}
+	cr.Name = "pvc-1"
+	cr.Namespace = "openebs"
+	cr.VersionDetails.Desired = "3.0.0"
+	cr.VersionDetails.Status.Current = "2.12.2"
+
+	tests := map[string]struct {
+		maxFailures    int
+		failures       int
+		wantErr        bool
+		wantRolledBack bool
+	}{
+		"first failure is retried": {
+			maxFailures: 3,
+			wantErr:     true,
+		},
+		"last failure is rolled back": {
+			maxFailures:    3,
+			failures:       2,
+			wantRolledBack: true,
+		},
+		"rollback is disabled": {
+			failures: 10,
+			wantErr:  true,
+		},
+	}
+	ctrlSVC := &corev1.Service{}
+	ctrlSVC.Name = "pvc-1-jiva-ctrl-svc"
+	ctrlSVC.Namespace = "openebs"
+	ctrlSVC.Spec.Ports = defaultControllerSVCPorts()[:2]
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			jv := cr.DeepCopy()
+			if tt.failures > 0 {
+				jv.Annotations = map[string]string{upgradeFailuresAnnotation: fmt.Sprint(tt.failures)}
+			}
+			r := &JivaVolumeReconciler{
+				Client: fake.NewClientBuilder().WithScheme(s).
+					WithObjects(jv, oldReplicaStatefulSet(3), ctrlSVC.DeepCopy()).Build(),
+				Scheme:             s,
+				Recorder:           record.NewFakeRecorder(10),
+				MaxUpgradeFailures: tt.maxFailures,
+			}
+			if err := r.snapshotComponents(jv); err != nil {
+				t.Fatal(err)
+			}
+
+			// upgrade the service and the replicas as the upgrade func would
+			if err := r.upgradeControllerService(jv, true); err != nil {
+				t.Fatal(err)
+			}
+			replicaSTS := &appsv1.StatefulSet{}
+			key := types.NamespacedName{Name: "pvc-1-jiva-rep", Namespace: "openebs"}
+			if err := r.Get(context.TODO(), key, replicaSTS); err != nil {
+				t.Fatal(err)
+			}
+			newReplicaSTS := replicaSTS.DeepCopy()
+			setVersionLabel(newReplicaSTS.Labels)
+			setContainerImage(&newReplicaSTS.Spec.Template.Spec, "jiva-replica", "openebs/jiva:3.0.0")
+			if err := r.startReplicaRollout(replicaSTS, newReplicaSTS); err != nil {
+				t.Fatal(err)
+			}
+
+			upgradeErr := r.setUpgradeError(jv, fmt.Errorf("replica pod failed"))
+			if gotErr := upgradeErr != nil; gotErr != tt.wantErr {
+				t.Fatalf("setUpgradeError() err = %v, wantErr %v", upgradeErr, tt.wantErr)
+			}
+
+			got := &openebsiov1alpha1.JivaVolume{}
+			if err := r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1", Namespace: "openebs"}, got); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Get(context.TODO(), key, replicaSTS); err != nil {
+				t.Fatal(err)
+			}
+			image := replicaSTS.Spec.Template.Spec.Containers[0].Image
+			svc := &corev1.Service{}
+			if err := r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1-jiva-ctrl-svc", Namespace: "openebs"}, svc); err != nil {
+				t.Fatal(err)
+			}
+			err := r.Get(context.TODO(), types.NamespacedName{Name: upgradeSnapshotName(jv), Namespace: "openebs"},
+				&corev1.ConfigMap{})
+
+			if !tt.wantRolledBack {
+				if got.Annotations[upgradeFailuresAnnotation] != fmt.Sprint(tt.failures+1) {
+					t.Errorf("failures = %s, want %d", got.Annotations[upgradeFailuresAnnotation], tt.failures+1)
+				}
+				if image != "openebs/jiva:3.0.0" {
+					t.Errorf("replica image = %s, want the upgraded image", image)
+				}
+				if len(svc.Spec.Ports) != 3 {
+					t.Errorf("service ports = %v, want the migrated ports", svc.Spec.Ports)
+				}
+				if err != nil {
+					t.Errorf("upgrade snapshot should be kept: %v", err)
+				}
+				return
+			}
+			if !isRolledBack(got) || got.Annotations[upgradeRolledBackAnnotation] != "3.0.0" {
+				t.Errorf("volume is not rolled back, annotations %v, version details %+v",
+					got.Annotations, got.VersionDetails)
+			}
+			if got.VersionDetails.Status.Reason != "replica pod failed" {
+				t.Errorf("reason = %q", got.VersionDetails.Status.Reason)
+			}
+			if image != "openebs/jiva:2.12.2" {
+				t.Errorf("replica image = %s, want openebs/jiva:2.12.2", image)
+			}
+			if len(svc.Spec.Ports) != 2 {
+				t.Errorf("service ports = %v, want the ports of 2.12.2", svc.Spec.Ports)
+			}
+			if v := replicaSTS.Labels["openebs.io/version"]; v != "2.12.2" {
+				t.Errorf("replica version label = %s, want 2.12.2", v)
+			}
+			// the replicas are restored one at a time by restoreReplicas
+			if p := replicaSTS.Spec.UpdateStrategy.RollingUpdate.Partition; p == nil || *p != 3 {
+				t.Errorf("partition = %v, want 3", p)
+			}
+			if !errors.IsNotFound(err) {
+				t.Errorf("upgrade snapshot should be deleted, got err %v", err)
+			}
+			if ok, err := r.shouldReconcile(got); ok || err != nil {
+				t.Errorf("shouldReconcile() = %v, %v, want false, nil", ok, err)
+			}
+		})
+	}
+}
+
+func TestAreRestoredReplicasRW(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	pod := func(ordinal int, revision string, ready bool) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Name = fmt.Sprintf("pvc-1-jiva-rep-%d", ordinal)
+		p.Namespace = "openebs"
+		p.Labels = map[string]string{
+			"openebs.io/component":                "jiva-replica",
+			"openebs.io/persistent-volume":        "pvc-1",
+			appsv1.ControllerRevisionHashLabelKey: revision,
+		}
+		p.Status.PodIP = fmt.Sprintf("10.0.0.%d", ordinal)
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+		return p
+	}
+	rw := func(ordinals ...int) []openebsiov1alpha1.ReplicaStatus {
+		var statuses []openebsiov1alpha1.ReplicaStatus
+		for _, o := range ordinals {
+			statuses = append(statuses, openebsiov1alpha1.ReplicaStatus{
+				Address: fmt.Sprintf("tcp://10.0.0.%d:9502", o), Mode: "RW"})
+		}
+		return statuses
+	}
+
+	tests := map[string]struct {
+		partition int32
+		pods      []*corev1.Pod
+		statuses  []openebsiov1alpha1.ReplicaStatus
+		want      bool
+	}{
+		"restored replica is RW": {
+			partition: 2,
+			pods:      []*corev1.Pod{pod(0, "old", true), pod(1, "new", false), pod(2, "old", true)},
+			statuses:  rw(0, 2),
+			want:      true,
+		},
+		"restored replica is not RW": {
+			partition: 2,
+			pods:      []*corev1.Pod{pod(0, "old", true), pod(1, "new", true), pod(2, "old", true)},
+			statuses:  rw(0, 1),
+		},
+		"restored replica is not ready": {
+			partition: 2,
+			pods:      []*corev1.Pod{pod(0, "old", true), pod(1, "old", true), pod(2, "old", false)},
+			statuses:  rw(0, 1, 2),
+		},
+		"replica is yet to be restarted": {
+			partition: 2,
+			pods:      []*corev1.Pod{pod(0, "old", true), pod(1, "old", true), pod(2, "new", true)},
+			statuses:  rw(0, 1, 2),
+		},
+		"replica pod is yet to be recreated": {
+			partition: 2,
+			pods:      []*corev1.Pod{pod(0, "old", true), pod(1, "new", true)},
+			statuses:  rw(0, 1),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(s)
+			for _, p := range tt.pods {
+				builder = builder.WithObjects(p)
+			}
+			r := &JivaVolumeReconciler{Client: builder.Build(), Scheme: s}
+			cr := &openebsiov1alpha1.JivaVolume{}
+			cr.Name = "pvc-1"
+			cr.Namespace = "openebs"
+			cr.Status.ReplicaStatuses = tt.statuses
+			replicaSTS := oldReplicaStatefulSet(3)
+			replicaSTS.Status.UpdateRevision = "old"
+
+			got, err := r.areRestoredReplicasRW(cr, replicaSTS, tt.partition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("areRestoredReplicasRW() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
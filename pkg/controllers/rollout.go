@@ -0,0 +1,334 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+const (
+	// policyHashAnnotation holds the hash of the policy fields
+	// the pod template of the target deployment or the replica
+	// statefulset was last built from
+	policyHashAnnotation = "openebs.io/policy-hash"
+)
+
+// policyHash returns the hash of the json encoding of the given fields
+func policyHash(fields interface{}) string {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		// the policy fields are always encodable
+		return ""
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(data)
+	return fmt.Sprintf("%x", h.Sum32())
+}
+
+// targetPolicyHash returns the hash of the policy fields used in the pod
+// template of the target deployment. The replication factor is left out
+// as it is updated on the deployment by the scaling of the replicas.
+func targetPolicyHash(policy openebsiov1alpha1.JivaVolumePolicySpec) string {
+	return policyHash(struct {
+		ServiceAccountName string
+		PriorityClassName  string
+		DisableMonitor     bool
+		Pod                openebsiov1alpha1.PodTemplateResources
+		AuxResources       *corev1.ResourceRequirements
+	}{
+		policy.ServiceAccountName,
+		policy.PriorityClassName,
+		policy.Target.DisableMonitor,
+		policy.Target.PodTemplateResources,
+		policy.Target.AuxResources,
+	})
+}
+
+// replicaPolicyHash returns the hash of the policy fields
+// used in the pod template of the replica statefulset
+func replicaPolicyHash(policy openebsiov1alpha1.JivaVolumePolicySpec) string {
+	return policyHash(struct {
+		ServiceAccountName string
+		PriorityClassName  string
+		Pod                openebsiov1alpha1.PodTemplateResources
+	}{
+		policy.ServiceAccountName,
+		policy.PriorityClassName,
+		policy.Replica.PodTemplateResources,
+	})
+}
+
+// applyPolicyUpdate copies the fields of the policy which can be changed
+// on an existing volume. The replication factor and the storage class of
+// the replicas are only used while provisioning the volume.
+func applyPolicyUpdate(dst *openebsiov1alpha1.JivaVolumePolicySpec, src openebsiov1alpha1.JivaVolumePolicySpec) {
+	dst.ServiceAccountName = src.ServiceAccountName
+	dst.PriorityClassName = src.PriorityClassName
+	dst.StatusPoll = src.StatusPoll
+	dst.Target.DisableMonitor = src.Target.DisableMonitor
+	dst.Target.PodTemplateResources = src.Target.PodTemplateResources
+	dst.Target.AuxResources = src.Target.AuxResources
+	dst.Replica = src.Replica
+}
+
+// isReplicaSetHealthy checks if all the desired replicas are connected
+// to the target in RW mode, so that a replica can be restarted without
+// the volume losing its quorum
+func isReplicaSetHealthy(cr *openebsiov1alpha1.JivaVolume) bool {
+	rf := cr.Spec.Policy.Target.ReplicationFactor
+	if cr.Status.Scaleup != nil || len(cr.Status.ReplicaStatuses) != rf {
+		return false
+	}
+	for _, rep := range cr.Status.ReplicaStatuses {
+		if rep.Mode != "RW" {
+			return false
+		}
+	}
+	return true
+}
+
+// rolloutPolicy rolls out the changes in the policy of the volume to the
+// replica statefulset and then to the target deployment. The replicas are
+// restarted one at a time, the next one only once all the replicas are
+// back in RW mode. True is returned while the rollout is in progress.
+func (r *JivaVolumeReconciler) rolloutPolicy(cr *openebsiov1alpha1.JivaVolume) (bool, error) {
+	inProgress, err := r.rolloutReplicaPolicy(cr)
+	if err != nil || inProgress {
+		return inProgress, err
+	}
+	return r.rolloutTargetPolicy(cr)
+}
+
+func (r *JivaVolumeReconciler) rolloutReplicaPolicy(cr *openebsiov1alpha1.JivaVolume) (bool, error) {
+	replicaSTS := &appsv1.StatefulSet{}
+	err := r.Get(context.TODO(),
+		types.NamespacedName{Name: cr.Name + "-jiva-rep", Namespace: cr.Namespace}, replicaSTS)
+	if err != nil {
+		return false, err
+	}
+
+	hash := replicaPolicyHash(cr.Spec.Policy)
+	current, ok := replicaSTS.Annotations[policyHashAnnotation]
+	if !ok {
+		// the statefulset was created before the policy changes were
+		// propagated, so it is built from the policy of the volume
+		return false, r.setPolicyHash(replicaSTS, hash)
+	}
+
+	if current != hash {
+		if !isReplicaSetHealthy(cr) {
+			logrus.Infof("waiting for all the replicas of volume %s to be RW to update the policy", cr.Name)
+			return true, nil
+		}
+		// only the policy fields of the template are rolled out,
+		// so the source of a cloned volume is not looked up
+		desired, err := r.buildReplicaStatefulSet(cr, nil)
+		if err != nil {
+			return false, err
+		}
+		newReplicaSTS := replicaSTS.DeepCopy()
+		setPolicyHashAnnotation(newReplicaSTS, hash)
+		copyReplicaPodTemplate(&newReplicaSTS.Spec.Template, desired.Spec.Template)
+		logrus.Infof("updating replica statefulset of volume %s with the policy changes", cr.Name)
+		r.Recorder.Event(cr, corev1.EventTypeNormal, "PolicyUpdate",
+			"rolling out the policy changes to the replicas")
+		return true, r.startReplicaRollout(replicaSTS, newReplicaSTS)
+	}
+	return r.stepReplicaRollout(cr, replicaSTS)
+}
+
+// startReplicaRollout patches the replica statefulset with the updated pod
+// template. None of the replicas is restarted until the partition of the
+// rolling update is lowered by stepReplicaRollout, one replica at a time.
+func (r *JivaVolumeReconciler) startReplicaRollout(replicaSTS, newReplicaSTS *appsv1.StatefulSet) error {
+	partition := *replicaSTS.Spec.Replicas
+	newReplicaSTS.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+		Type: appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+			Partition: &partition,
+		},
+	}
+	return r.Patch(context.TODO(), newReplicaSTS, client.MergeFrom(replicaSTS))
+}
+
+// stepReplicaRollout lets the statefulset restart the next replica with
+// the updated pod template once the replicas restarted so far are back
+// in RW mode. True is returned till all the replicas are restarted and
+// the last restarted replica is back in RW mode.
+func (r *JivaVolumeReconciler) stepReplicaRollout(cr *openebsiov1alpha1.JivaVolume,
+	replicaSTS *appsv1.StatefulSet) (bool, error) {
+	rollingUpdate := replicaSTS.Spec.UpdateStrategy.RollingUpdate
+	if rollingUpdate == nil || rollingUpdate.Partition == nil {
+		return false, nil
+	}
+	partition := *rollingUpdate.Partition
+	replicas := *replicaSTS.Spec.Replicas
+	healthy := replicaSTS.Status.ReadyReplicas == replicas && isReplicaSetHealthy(cr)
+	if isRolledBack(cr) {
+		// the replicas left unhealthy by the failed upgrade
+		// are only restored in their turn
+		var err error
+		healthy, err = r.areRestoredReplicasRW(cr, replicaSTS, partition)
+		if err != nil {
+			return false, err
+		}
+	}
+	if replicaSTS.Status.ObservedGeneration != replicaSTS.Generation ||
+		replicaSTS.Status.UpdatedReplicas < replicas-partition ||
+		!healthy {
+		logrus.Infof("waiting for the updated replicas of volume %s to be RW", cr.Name)
+		return true, nil
+	}
+	if partition == 0 {
+		// all the replicas are restarted and back in RW mode
+		return false, nil
+	}
+	if partition > replicas {
+		partition = replicas
+	}
+	partition--
+	newReplicaSTS := replicaSTS.DeepCopy()
+	newReplicaSTS.Spec.UpdateStrategy.RollingUpdate.Partition = &partition
+	logrus.Infof("restarting replica %s-%d of volume %s", replicaSTS.Name, partition, cr.Name)
+	return true, r.Patch(context.TODO(), newReplicaSTS, client.MergeFrom(replicaSTS))
+}
+
+func (r *JivaVolumeReconciler) rolloutTargetPolicy(cr *openebsiov1alpha1.JivaVolume) (bool, error) {
+	ctrlDeploy := &appsv1.Deployment{}
+	err := r.Get(context.TODO(),
+		types.NamespacedName{Name: cr.Name + "-jiva-ctrl", Namespace: cr.Namespace}, ctrlDeploy)
+	if err != nil {
+		return false, err
+	}
+
+	hash := targetPolicyHash(cr.Spec.Policy)
+	current, ok := ctrlDeploy.Annotations[policyHashAnnotation]
+	if !ok {
+		return false, r.setPolicyHash(ctrlDeploy, hash)
+	}
+	if current == hash {
+		return false, nil
+	}
+	// restarting the target of a degraded volume
+	// could keep it from coming back online
+	if !isReplicaSetHealthy(cr) {
+		logrus.Infof("waiting for all the replicas of volume %s to be RW to update the policy", cr.Name)
+		return true, nil
+	}
+
+	desired, err := buildControllerDeployment(cr)
+	if err != nil {
+		return false, err
+	}
+	newCtrlDeploy := ctrlDeploy.DeepCopy()
+	setPolicyHashAnnotation(newCtrlDeploy, hash)
+	copyTargetPodTemplate(&newCtrlDeploy.Spec.Template, desired.Spec.Template)
+	logrus.Infof("updating target deployment of volume %s with the policy changes", cr.Name)
+	r.Recorder.Event(cr, corev1.EventTypeNormal, "PolicyUpdate",
+		"rolling out the policy changes to the target")
+	return true, r.Patch(context.TODO(), newCtrlDeploy, client.MergeFrom(ctrlDeploy))
+}
+
+// setPolicyHash sets the policy hash annotation without changing the
+// pod template, so the pods are not restarted
+func (r *JivaVolumeReconciler) setPolicyHash(obj client.Object, hash string) error {
+	newObj := obj.DeepCopyObject().(client.Object)
+	setPolicyHashAnnotation(newObj, hash)
+	return r.Patch(context.TODO(), newObj, client.MergeFrom(obj))
+}
+
+func setPolicyHashAnnotation(obj client.Object, hash string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[policyHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+}
+
+// copyPodScheduling copies the fields of the pod spec set by the policy
+func copyPodScheduling(dst *corev1.PodSpec, src corev1.PodSpec) {
+	dst.ServiceAccountName = src.ServiceAccountName
+	dst.PriorityClassName = src.PriorityClassName
+	// the priority is resolved again from the priority class
+	dst.Priority = nil
+	dst.Tolerations = src.Tolerations
+	dst.Affinity = src.Affinity
+	dst.NodeSelector = src.NodeSelector
+}
+
+// copyReplicaPodTemplate copies the fields set by the policy to the
+// replica pod template, the rest is kept as is to not restart the
+// replicas with a different image or arguments
+func copyReplicaPodTemplate(dst *corev1.PodTemplateSpec, src corev1.PodTemplateSpec) {
+	copyPodScheduling(&dst.Spec, src.Spec)
+	for key, value := range src.Labels {
+		if dst.Labels == nil {
+			dst.Labels = map[string]string{}
+		}
+		dst.Labels[key] = value
+	}
+	for i := range dst.Spec.Containers {
+		if dst.Spec.Containers[i].Name != "jiva-replica" {
+			continue
+		}
+		for _, con := range src.Spec.Containers {
+			if con.Name == "jiva-replica" {
+				dst.Spec.Containers[i].Resources = con.Resources
+			}
+		}
+	}
+}
+
+// copyTargetPodTemplate copies the fields set by the policy to the
+// target pod template, the monitor sidecar is added or removed as per
+// the policy
+func copyTargetPodTemplate(dst *corev1.PodTemplateSpec, src corev1.PodTemplateSpec) {
+	copyPodScheduling(&dst.Spec, src.Spec)
+	srcContainers := map[string]corev1.Container{}
+	for _, con := range src.Spec.Containers {
+		srcContainers[con.Name] = con
+	}
+	containers := []corev1.Container{}
+	seen := map[string]bool{}
+	for _, con := range dst.Spec.Containers {
+		srcCon, ok := srcContainers[con.Name]
+		if !ok {
+			continue
+		}
+		con.Resources = srcCon.Resources
+		containers = append(containers, con)
+		seen[con.Name] = true
+	}
+	for _, con := range src.Spec.Containers {
+		if !seen[con.Name] {
+			containers = append(containers, con)
+		}
+	}
+	dst.Spec.Containers = containers
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+func TestPolicyHash(t *testing.T) {
+	policy := getDefaultPolicySpec()
+	target, replica := targetPolicyHash(policy), replicaPolicyHash(policy)
+
+	scaled := getDefaultPolicySpec()
+	scaled.Target.ReplicationFactor = 5
+	if targetPolicyHash(scaled) != target || replicaPolicyHash(scaled) != replica {
+		t.Errorf("hash changed with the replication factor")
+	}
+
+	monitor := getDefaultPolicySpec()
+	monitor.Target.DisableMonitor = true
+	if targetPolicyHash(monitor) == target {
+		t.Errorf("target hash not changed with the monitor toggle")
+	}
+	if replicaPolicyHash(monitor) != replica {
+		t.Errorf("replica hash changed with the monitor toggle")
+	}
+
+	priority := getDefaultPolicySpec()
+	priority.PriorityClassName = "high"
+	if targetPolicyHash(priority) == target || replicaPolicyHash(priority) == replica {
+		t.Errorf("hash not changed with the priority class")
+	}
+}
+
+func TestIsReplicaSetHealthy(t *testing.T) {
+	tests := []struct {
+		name    string
+		rf      int
+		modes   []string
+		scaleup bool
+		want    bool
+	}{
+		{name: "all replicas RW", rf: 3, modes: []string{"RW", "RW", "RW"}, want: true},
+		{name: "replica rebuilding", rf: 3, modes: []string{"RW", "RW", "WO"}},
+		{name: "replica missing", rf: 3, modes: []string{"RW", "RW"}},
+		{name: "scaleup in progress", rf: 3, modes: []string{"RW", "RW", "RW"}, scaleup: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &openebsiov1alpha1.JivaVolume{}
+			cr.Spec.Policy.Target.ReplicationFactor = tt.rf
+			for _, mode := range tt.modes {
+				cr.Status.ReplicaStatuses = append(cr.Status.ReplicaStatuses,
+					openebsiov1alpha1.ReplicaStatus{Mode: mode})
+			}
+			if tt.scaleup {
+				cr.Status.Scaleup = &openebsiov1alpha1.ScaleupStatus{}
+			}
+			if got := isReplicaSetHealthy(cr); got != tt.want {
+				t.Errorf("isReplicaSetHealthy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepReplicaRollout(t *testing.T) {
+	int32Ptr := func(i int32) *int32 { return &i }
+	tests := []struct {
+		name           string
+		partition      *int32
+		staleGen       bool
+		updated        int32
+		lastMode       string
+		wantInProgress bool
+		wantPartition  *int32
+	}{
+		{
+			name:     "no rollout",
+			updated:  3,
+			lastMode: "RW",
+		},
+		{
+			name:           "next replica is restarted",
+			partition:      int32Ptr(2),
+			updated:        1,
+			lastMode:       "RW",
+			wantInProgress: true,
+			wantPartition:  int32Ptr(1),
+		},
+		{
+			name:           "restarted replica is not RW",
+			partition:      int32Ptr(2),
+			updated:        1,
+			lastMode:       "WO",
+			wantInProgress: true,
+			wantPartition:  int32Ptr(2),
+		},
+		{
+			name:           "last restarted replica is not RW",
+			partition:      int32Ptr(0),
+			updated:        3,
+			lastMode:       "WO",
+			wantInProgress: true,
+			wantPartition:  int32Ptr(0),
+		},
+		{
+			name:           "last replica is not restarted yet",
+			partition:      int32Ptr(0),
+			updated:        2,
+			lastMode:       "RW",
+			wantInProgress: true,
+			wantPartition:  int32Ptr(0),
+		},
+		{
+			name:           "last step is not observed yet",
+			partition:      int32Ptr(0),
+			staleGen:       true,
+			updated:        3,
+			lastMode:       "RW",
+			wantInProgress: true,
+			wantPartition:  int32Ptr(0),
+		},
+		{
+			name:          "all the replicas are restarted and RW",
+			partition:     int32Ptr(0),
+			updated:       3,
+			lastMode:      "RW",
+			wantPartition: int32Ptr(0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &openebsiov1alpha1.JivaVolume{}
+			cr.Name = "pvc-1"
+			cr.Namespace = "openebs"
+			cr.Spec.Policy.Target.ReplicationFactor = 3
+			for _, mode := range []string{"RW", "RW", tt.lastMode} {
+				cr.Status.ReplicaStatuses = append(cr.Status.ReplicaStatuses,
+					openebsiov1alpha1.ReplicaStatus{Mode: mode})
+			}
+
+			replicaSTS := oldReplicaStatefulSet(3)
+			replicaSTS.Generation = 2
+			if tt.partition != nil {
+				replicaSTS.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{
+					Partition: tt.partition,
+				}
+			}
+			replicaSTS.Status.ObservedGeneration = 2
+			if tt.staleGen {
+				replicaSTS.Status.ObservedGeneration = 1
+			}
+			replicaSTS.Status.ReadyReplicas = 3
+			replicaSTS.Status.UpdatedReplicas = tt.updated
+
+			r := &JivaVolumeReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(replicaSTS.DeepCopy()).Build(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+			if err := r.Get(context.TODO(),
+				types.NamespacedName{Name: "pvc-1-jiva-rep", Namespace: "openebs"}, replicaSTS); err != nil {
+				t.Fatal(err)
+			}
+			inProgress, err := r.stepReplicaRollout(cr, replicaSTS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inProgress != tt.wantInProgress {
+				t.Errorf("stepReplicaRollout() = %v, want %v", inProgress, tt.wantInProgress)
+			}
+
+			got := &appsv1.StatefulSet{}
+			if err := r.Get(context.TODO(),
+				types.NamespacedName{Name: "pvc-1-jiva-rep", Namespace: "openebs"}, got); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantPartition == nil {
+				return
+			}
+			if p := got.Spec.UpdateStrategy.RollingUpdate.Partition; p == nil || *p != *tt.wantPartition {
+				t.Errorf("partition = %v, want %d", p, *tt.wantPartition)
+			}
+		})
+	}
+}
+
+func TestCopyTargetPodTemplate(t *testing.T) {
+	cpu := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+	}
+	tests := []struct {
+		name string
+		dst  []corev1.Container
+		src  []corev1.Container
+		want []string
+	}{
+		{
+			name: "monitor disabled",
+			dst:  []corev1.Container{{Name: "jiva-controller", Image: "old"}, {Name: "maya-volume-exporter"}},
+			src:  []corev1.Container{{Name: "jiva-controller", Image: "new", Resources: cpu}},
+			want: []string{"jiva-controller"},
+		},
+		{
+			name: "monitor enabled",
+			dst:  []corev1.Container{{Name: "jiva-controller", Image: "old"}},
+			src:  []corev1.Container{{Name: "jiva-controller", Image: "new", Resources: cpu}, {Name: "maya-volume-exporter"}},
+			want: []string{"jiva-controller", "maya-volume-exporter"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: tt.dst}}
+			src := corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers:        tt.src,
+				PriorityClassName: "high",
+			}}
+			copyTargetPodTemplate(&dst, src)
+			if len(dst.Spec.Containers) != len(tt.want) {
+				t.Fatalf("got %d containers, want %v", len(dst.Spec.Containers), tt.want)
+			}
+			for i, name := range tt.want {
+				if dst.Spec.Containers[i].Name != name {
+					t.Errorf("container %d = %s, want %s", i, dst.Spec.Containers[i].Name, name)
+				}
+			}
+			ctrl := dst.Spec.Containers[0]
+			if ctrl.Image != "old" {
+				t.Errorf("image of the target changed to %s", ctrl.Image)
+			}
+			if !ctrl.Resources.Limits.Cpu().Equal(resource.MustParse("1")) {
+				t.Errorf("resources of the target not updated")
+			}
+			if dst.Spec.PriorityClassName != "high" {
+				t.Errorf("priority class not updated")
+			}
+		})
+	}
+}
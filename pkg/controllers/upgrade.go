@@ -0,0 +1,295 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/openebs/jiva-operator/version"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+type upgradeParams struct {
+	j *openebsiov1alpha1.JivaVolume
+	r *JivaVolumeReconciler
+}
+
+// upgradeFunc migrates the components of the volume from the version the
+// function is registered for to the version of the operator. It is called
+// on every reconcile of the volume till it returns true, so each call
+// carries out the next step of the upgrade.
+type upgradeFunc func(u *upgradeParams) (bool, error)
+
+var (
+	// upgradeMap registers the upgrade paths of the releases which need
+	// more than upgradeComponents to be upgraded to the version of the
+	// operator, keyed by the release without the pre-release
+	upgradeMap = map[string]upgradeFunc{}
+
+	// migratedReleases are the releases whose components are built with
+	// the args, env and ports of their own release, they are migrated to
+	// the ones of the operator as the components are upgraded
+	migratedReleases = []string{
+		"2.6.0", "2.7.0", "2.8.0", "2.9.0", "2.10.0",
+		"2.11.0", "2.12.0", "2.12.1", "2.12.2",
+	}
+)
+
+func init() {
+	for _, release := range migratedReleases {
+		upgradeMap[release] = upgradeRelease
+	}
+}
+
+// getUpgradeFunc returns the upgrade path of the given version, the
+// releases which are not registered in upgradeMap are upgraded by
+// upgradeComponents
+func getUpgradeFunc(current string) upgradeFunc {
+	if f, ok := upgradeMap[strings.Split(current, "-")[0]]; ok {
+		return f
+	}
+	return upgradeComponents
+}
+
+// upgradeComponents moves the replicas and then the target of the volume
+// to the images and the version label of the operator. The replicas are
+// restarted one at a time, the next one once all the replicas are RW.
+func upgradeComponents(u *upgradeParams) (bool, error) {
+	return upgradeComponentsWith(u, false)
+}
+
+// upgradeRelease upgrades the components of an earlier release along
+// with migrating the args, env and ports of their containers and the
+// ports of the target service to the ones the operator builds
+func upgradeRelease(u *upgradeParams) (bool, error) {
+	return upgradeComponentsWith(u, true)
+}
+
+func upgradeComponentsWith(u *upgradeParams, migrate bool) (bool, error) {
+	if err := u.r.upgradeControllerService(u.j, migrate); err != nil {
+		return false, err
+	}
+	inProgress, err := u.r.upgradeReplicaStatefulSet(u.j, migrate)
+	if err != nil || inProgress {
+		return false, err
+	}
+	inProgress, err = u.r.upgradeControllerDeployment(u.j, migrate)
+	if err != nil || inProgress {
+		return false, err
+	}
+	return true, nil
+}
+
+// migrateContainers sets the command, args, env and ports of the
+// containers of spec to the ones of the same containers in desired,
+// true is returned if any of the containers is changed
+func migrateContainers(spec *corev1.PodSpec, desired corev1.PodSpec) bool {
+	changed := false
+	for i := range spec.Containers {
+		con := &spec.Containers[i]
+		for _, want := range desired.Containers {
+			if want.Name != con.Name {
+				continue
+			}
+			if !reflect.DeepEqual(con.Command, want.Command) ||
+				!reflect.DeepEqual(con.Args, want.Args) ||
+				!reflect.DeepEqual(con.Env, want.Env) ||
+				!reflect.DeepEqual(con.Ports, want.Ports) {
+				con.Command = want.Command
+				con.Args = want.Args
+				con.Env = want.Env
+				con.Ports = want.Ports
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// setVersionLabel sets the version label of the operator, true is
+// returned if the labels are changed
+func setVersionLabel(labels map[string]string) bool {
+	if labels["openebs.io/version"] == version.Version {
+		return false
+	}
+	labels["openebs.io/version"] = version.Version
+	return true
+}
+
+// setContainerImage sets the image of the named container, true is
+// returned if the image is changed
+func setContainerImage(spec *corev1.PodSpec, name, image string) bool {
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == name && spec.Containers[i].Image != image {
+			spec.Containers[i].Image = image
+			return true
+		}
+	}
+	return false
+}
+
+// upgradeControllerService updates the version label of the target
+// service, the ports are migrated to the ones of the operator if asked
+func (r *JivaVolumeReconciler) upgradeControllerService(cr *openebsiov1alpha1.JivaVolume, migrate bool) error {
+	ctrlSVC := &corev1.Service{}
+	err := r.Get(context.TODO(),
+		types.NamespacedName{Name: cr.Name + "-jiva-ctrl-svc", Namespace: cr.Namespace}, ctrlSVC)
+	if err != nil {
+		// the service is created with the
+		// labels of the operator later on
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	newCtrlSVC := ctrlSVC.DeepCopy()
+	if newCtrlSVC.Labels == nil {
+		newCtrlSVC.Labels = map[string]string{}
+	}
+	changed := setVersionLabel(newCtrlSVC.Labels)
+	if migrate && !reflect.DeepEqual(newCtrlSVC.Spec.Ports, defaultControllerSVCPorts()) {
+		newCtrlSVC.Spec.Ports = defaultControllerSVCPorts()
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return r.Patch(context.TODO(), newCtrlSVC, client.MergeFrom(ctrlSVC))
+}
+
+// upgradeReplicaStatefulSet updates the replica image and the version
+// label of the replica statefulset, along with the args, env and ports
+// of the replica if asked to migrate them. True is returned while the
+// replicas are being restarted.
+func (r *JivaVolumeReconciler) upgradeReplicaStatefulSet(cr *openebsiov1alpha1.JivaVolume, migrate bool) (bool, error) {
+	replicaSTS := &appsv1.StatefulSet{}
+	err := r.Get(context.TODO(),
+		types.NamespacedName{Name: cr.Name + "-jiva-rep", Namespace: cr.Namespace}, replicaSTS)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	newReplicaSTS := replicaSTS.DeepCopy()
+	if newReplicaSTS.Labels == nil {
+		newReplicaSTS.Labels = map[string]string{}
+	}
+	labelChanged := setVersionLabel(newReplicaSTS.Labels)
+	templateChanged := setVersionLabel(newReplicaSTS.Spec.Template.Labels)
+	if setContainerImage(&newReplicaSTS.Spec.Template.Spec, "jiva-replica",
+		getImage("OPENEBS_IO_JIVA_REPLICA_IMAGE", "jiva-replica")) {
+		templateChanged = true
+	}
+	if migrate {
+		// the replicas are restarted after the clone
+		// is completed, so the source is not looked up
+		desired, err := r.buildReplicaStatefulSet(cr, nil)
+		if err != nil {
+			return false, err
+		}
+		if migrateContainers(&newReplicaSTS.Spec.Template.Spec, desired.Spec.Template.Spec) {
+			templateChanged = true
+		}
+	}
+	if !templateChanged {
+		if labelChanged {
+			if err := r.Patch(context.TODO(), newReplicaSTS, client.MergeFrom(replicaSTS)); err != nil {
+				return false, err
+			}
+		}
+		return r.stepReplicaRollout(cr, replicaSTS)
+	}
+	if !isReplicaSetHealthy(cr) {
+		logrus.Infof("waiting for all the replicas of volume %s to be RW to upgrade", cr.Name)
+		return true, nil
+	}
+	logrus.Infof("upgrading replica statefulset of volume %s to %s", cr.Name, version.Version)
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, "Upgrade",
+		"upgrading the replicas to %s", version.Version)
+	return true, r.startReplicaRollout(replicaSTS, newReplicaSTS)
+}
+
+// upgradeControllerDeployment updates the target and exporter images and
+// the version label of the target deployment, along with the args, env
+// and ports of the containers if asked to migrate them. True is returned
+// till the upgraded target is available.
+func (r *JivaVolumeReconciler) upgradeControllerDeployment(cr *openebsiov1alpha1.JivaVolume, migrate bool) (bool, error) {
+	ctrlDeploy := &appsv1.Deployment{}
+	err := r.Get(context.TODO(),
+		types.NamespacedName{Name: cr.Name + "-jiva-ctrl", Namespace: cr.Namespace}, ctrlDeploy)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	newCtrlDeploy := ctrlDeploy.DeepCopy()
+	if newCtrlDeploy.Labels == nil {
+		newCtrlDeploy.Labels = map[string]string{}
+	}
+	changed := setVersionLabel(newCtrlDeploy.Labels)
+	if setVersionLabel(newCtrlDeploy.Spec.Template.Labels) {
+		changed = true
+	}
+	if setContainerImage(&newCtrlDeploy.Spec.Template.Spec, "jiva-controller",
+		getImage("OPENEBS_IO_JIVA_CONTROLLER_IMAGE", "jiva-controller")) {
+		changed = true
+	}
+	if setContainerImage(&newCtrlDeploy.Spec.Template.Spec, "maya-volume-exporter",
+		getImage("OPENEBS_IO_MAYA_EXPORTER_IMAGE", "exporter")) {
+		changed = true
+	}
+	if migrate {
+		desired, err := buildControllerDeployment(cr)
+		if err != nil {
+			return false, err
+		}
+		if migrateContainers(&newCtrlDeploy.Spec.Template.Spec, desired.Spec.Template.Spec) {
+			changed = true
+		}
+	}
+	if !changed {
+		// wait for the target to be recreated with the new image
+		replicas := int32(1)
+		if ctrlDeploy.Spec.Replicas != nil {
+			replicas = *ctrlDeploy.Spec.Replicas
+		}
+		if ctrlDeploy.Status.ObservedGeneration < ctrlDeploy.Generation ||
+			ctrlDeploy.Status.UpdatedReplicas < replicas ||
+			ctrlDeploy.Status.AvailableReplicas < replicas {
+			logrus.Infof("waiting for the upgraded target of volume %s to be available", cr.Name)
+			return true, nil
+		}
+		return false, nil
+	}
+	logrus.Infof("upgrading target deployment of volume %s to %s", cr.Name, version.Version)
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, "Upgrade",
+		"upgrading the target to %s", version.Version)
+	return true, r.Patch(context.TODO(), newCtrlDeploy, client.MergeFrom(ctrlDeploy))
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/openebs/jiva-operator/version"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+func oldReplicaStatefulSet(replicas int32) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pvc-1-jiva-rep",
+			Namespace: "openebs",
+			Labels:    map[string]string{"openebs.io/version": "2.12.2"},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"openebs.io/version": "2.12.2"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "jiva-replica", Image: "openebs/jiva:2.12.2"}},
+				},
+			},
+		},
+	}
+}
+
+func TestUpgradeReplicaStatefulSet(t *testing.T) {
+	cr := &openebsiov1alpha1.JivaVolume{}
+	cr.Name = "pvc-1"
+	cr.Namespace = "openebs"
+	cr.Spec.Policy.Target.ReplicationFactor = 3
+	for i := 0; i < 3; i++ {
+		cr.Status.ReplicaStatuses = append(cr.Status.ReplicaStatuses,
+			openebsiov1alpha1.ReplicaStatus{Mode: "RW"})
+	}
+
+	r := &JivaVolumeReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(oldReplicaStatefulSet(3)).Build(),
+		Recorder: record.NewFakeRecorder(10),
+	}
+	inProgress, err := r.upgradeReplicaStatefulSet(cr, false)
+	if err != nil || !inProgress {
+		t.Fatalf("upgradeReplicaStatefulSet() = %v, %v, want in progress", inProgress, err)
+	}
+
+	replicaSTS := &appsv1.StatefulSet{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1-jiva-rep", Namespace: "openebs"}, replicaSTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := replicaSTS.Spec.Template.Spec.Containers[0].Image; got != getImage("OPENEBS_IO_JIVA_REPLICA_IMAGE", "jiva-replica") {
+		t.Errorf("replica image = %s", got)
+	}
+	if got := replicaSTS.Spec.Template.Labels["openebs.io/version"]; got != version.Version {
+		t.Errorf("replica version label = %s, want %s", got, version.Version)
+	}
+	partition := replicaSTS.Spec.UpdateStrategy.RollingUpdate.Partition
+	if partition == nil || *partition != 3 {
+		t.Errorf("partition = %v, want all the replicas held back", partition)
+	}
+
+	// the next replica is restarted once the
+	// statefulset has observed the update
+	replicaSTS.Status.ObservedGeneration = replicaSTS.Generation
+	replicaSTS.Status.ReadyReplicas = 3
+	if err := r.Update(context.TODO(), replicaSTS); err != nil {
+		t.Fatal(err)
+	}
+	inProgress, err = r.upgradeReplicaStatefulSet(cr, false)
+	if err != nil || !inProgress {
+		t.Fatalf("upgradeReplicaStatefulSet() = %v, %v, want in progress", inProgress, err)
+	}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1-jiva-rep", Namespace: "openebs"}, replicaSTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partition := replicaSTS.Spec.UpdateStrategy.RollingUpdate.Partition; *partition != 2 {
+		t.Errorf("partition = %d, want 2", *partition)
+	}
+
+	// a degraded volume waits for the replicas to be RW
+	cr.Status.ReplicaStatuses[0].Mode = "WO"
+	replicaSTS.Status.ObservedGeneration = replicaSTS.Generation
+	replicaSTS.Status.UpdatedReplicas = 1
+	if err := r.Update(context.TODO(), replicaSTS); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.upgradeReplicaStatefulSet(cr, false); err != nil {
+		t.Fatal(err)
+	}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1-jiva-rep", Namespace: "openebs"}, replicaSTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partition := replicaSTS.Spec.UpdateStrategy.RollingUpdate.Partition; *partition != 2 {
+		t.Errorf("partition = %d, want 2 while a replica is not RW", *partition)
+	}
+}
+
+func TestUpgradeReleaseMigration(t *testing.T) {
+	prevServiceAccount := defaultServiceAccountName
+	t.Cleanup(func() { defaultServiceAccountName = prevServiceAccount })
+	defaultServiceAccountName = "openebs-jiva-operator"
+
+	cr := &openebsiov1alpha1.JivaVolume{}
+	cr.Name = "pvc-1"
+	cr.Namespace = "openebs"
+	cr.Spec.PV = "pvc-1"
+	cr.Spec.Capacity = "1Gi"
+	cr.Spec.ISCSISpec.TargetIP = "10.0.0.10"
+	cr.Spec.Policy = getDefaultPolicySpec()
+	cr.Spec.Policy.Target.ReplicationFactor = 3
+	cr.VersionDetails.Status.Current = "2.12.2"
+	for i := 0; i < 3; i++ {
+		cr.Status.ReplicaStatuses = append(cr.Status.ReplicaStatuses,
+			openebsiov1alpha1.ReplicaStatus{Mode: "RW"})
+	}
+
+	// the components as built by the 2.12.2 operator
+	ctrlSVC := &corev1.Service{}
+	ctrlSVC.Name = "pvc-1-jiva-ctrl-svc"
+	ctrlSVC.Namespace = "openebs"
+	ctrlSVC.Spec.ClusterIP = "10.0.0.10"
+	ctrlSVC.Spec.Ports = defaultControllerSVCPorts()[:2]
+
+	replicaSTS := oldReplicaStatefulSet(3)
+	replicaSTS.Spec.Template.Spec.Containers[0].Args = []string{
+		"replica", "--frontendIP", "10.0.0.10", "openebs",
+	}
+	replicaSTS.Spec.Template.Spec.Containers[0].Env = []corev1.EnvVar{
+		{Name: "REPLICA_SYNC_TIMEOUT", Value: "10"},
+	}
+
+	ctrlDeploy := &appsv1.Deployment{}
+	ctrlDeploy.Name = "pvc-1-jiva-ctrl"
+	ctrlDeploy.Namespace = "openebs"
+	ctrlDeploy.Labels = map[string]string{"openebs.io/version": "2.12.2"}
+	ctrlDeploy.Spec.Template.Labels = map[string]string{"openebs.io/version": "2.12.2"}
+	ctrlDeploy.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name:    "jiva-controller",
+		Image:   "openebs/jiva:2.12.2",
+		Command: []string{"launch"},
+		Args:    []string{"controller", "--frontend", "gotgt", "--clusterIP", "10.0.0.10", "pvc-1"},
+		Env:     []corev1.EnvVar{{Name: "REPLICATION_FACTOR", Value: "1"}},
+	}}
+
+	r := &JivaVolumeReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(ctrlSVC, replicaSTS, ctrlDeploy).Build(),
+		Recorder: record.NewFakeRecorder(10),
+	}
+	upgrade := getUpgradeFunc(cr.VersionDetails.Status.Current)
+	done, err := upgrade(&upgradeParams{j: cr, r: r})
+	if err != nil || done {
+		t.Fatalf("upgrade() = %v, %v, want the replicas restarted", done, err)
+	}
+
+	gotSVC := &corev1.Service{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1-jiva-ctrl-svc", Namespace: "openebs"}, gotSVC); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotSVC.Spec.Ports, defaultControllerSVCPorts()) {
+		t.Errorf("service ports = %v, want %v", gotSVC.Spec.Ports, defaultControllerSVCPorts())
+	}
+
+	gotSTS := &appsv1.StatefulSet{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1-jiva-rep", Namespace: "openebs"}, gotSTS); err != nil {
+		t.Fatal(err)
+	}
+	replica := gotSTS.Spec.Template.Spec.Containers[0]
+	wantArgs := []string{"replica", "--frontendIP", "10.0.0.10", "--size", "1073741824", "openebs"}
+	if !reflect.DeepEqual(replica.Args, wantArgs) {
+		t.Errorf("replica args = %v, want %v", replica.Args, wantArgs)
+	}
+	if len(replica.Env) != 0 {
+		t.Errorf("replica env = %v, want the env of the release removed", replica.Env)
+	}
+	if !reflect.DeepEqual(replica.Ports, defaultReplicaPorts()) {
+		t.Errorf("replica ports = %v, want %v", replica.Ports, defaultReplicaPorts())
+	}
+
+	// the target is migrated once the replicas are restarted
+	inProgress, err := r.upgradeControllerDeployment(cr, true)
+	if err != nil || !inProgress {
+		t.Fatalf("upgradeControllerDeployment() = %v, %v, want in progress", inProgress, err)
+	}
+	gotDeploy := &appsv1.Deployment{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: "pvc-1-jiva-ctrl", Namespace: "openebs"}, gotDeploy); err != nil {
+		t.Fatal(err)
+	}
+	target := gotDeploy.Spec.Template.Spec.Containers[0]
+	wantEnv := []corev1.EnvVar{{Name: "REPLICATION_FACTOR", Value: "3"}}
+	if !reflect.DeepEqual(target.Env, wantEnv) {
+		t.Errorf("target env = %v, want %v", target.Env, wantEnv)
+	}
+	if !reflect.DeepEqual(target.Ports, defaultControllerPorts()) {
+		t.Errorf("target ports = %v, want %v", target.Ports, defaultControllerPorts())
+	}
+	if target.Image != getImage("OPENEBS_IO_JIVA_CONTROLLER_IMAGE", "jiva-controller") {
+		t.Errorf("target image = %s", target.Image)
+	}
+}
+
+func TestGetUpgradeFunc(t *testing.T) {
+	special := func(u *upgradeParams) (bool, error) { return true, nil }
+	prev := upgradeMap["2.6.0"]
+	upgradeMap["2.6.0"] = special
+	t.Cleanup(func() { upgradeMap["2.6.0"] = prev })
+
+	tests := []struct {
+		current string
+		want    upgradeFunc
+	}{
+		{current: "2.6.0", want: special},
+		{current: "2.6.0-RC1", want: special},
+		{current: "2.11.0-RC2", want: upgradeRelease},
+		{current: "2.12.2", want: upgradeRelease},
+		{current: "2.13.0", want: upgradeComponents},
+		{current: "3.0.0-RC1", want: upgradeComponents},
+	}
+	for _, tt := range tests {
+		t.Run(tt.current, func(t *testing.T) {
+			got := getUpgradeFunc(tt.current)
+			if reflect.ValueOf(got).Pointer() != reflect.ValueOf(tt.want).Pointer() {
+				t.Errorf("getUpgradeFunc(%s) returned the wrong upgrade path", tt.current)
+			}
+		})
+	}
+}
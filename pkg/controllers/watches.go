@@ -0,0 +1,118 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// podNodeNameField is the index of the pods on the name
+	// of the node they are scheduled on
+	podNodeNameField = "spec.nodeName"
+)
+
+// isJivaPod checks if the pod is a jiva controller or replica pod
+func isJivaPod(obj client.Object) bool {
+	component := obj.GetLabels()["openebs.io/component"]
+	return (component == "jiva-controller" || component == "jiva-replica") &&
+		obj.GetLabels()["openebs.io/persistent-volume"] != ""
+}
+
+// jivaPodPredicate filters the events of pods other than
+// the jiva controller and replica pods
+var jivaPodPredicate = predicate.NewPredicateFuncs(isJivaPod)
+
+// jivaVolumePredicate filters the updates of the JivaVolumes which only
+// change their status. The status is written by the reconciler on every
+// poll of the volume, and the volume is requeued at the poll interval
+// anyway, so reconciling on these updates would poll it in a loop.
+var jivaVolumePredicate = predicate.Or(
+	predicate.GenerationChangedPredicate{},
+	predicate.AnnotationChangedPredicate{},
+)
+
+// nodeReadinessPredicate passes the node events which can affect the
+// replicas, i.e. node deletion and the change of the node readiness.
+// The periodic heartbeat updates of the node status are filtered out.
+var nodeReadinessPredicate = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return false
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNode, ok := e.ObjectOld.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		newNode, ok := e.ObjectNew.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		return isNodeReady(oldNode) != isNodeReady(newNode)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return true
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return false
+	},
+}
+
+// jivaVolumeForPod maps a jiva controller or replica pod
+// to the JivaVolume it belongs to
+func jivaVolumeForPod(obj client.Object) []reconcile.Request {
+	if !isJivaPod(obj) {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{
+			Name:      obj.GetLabels()["openebs.io/persistent-volume"],
+			Namespace: obj.GetNamespace(),
+		},
+	}}
+}
+
+// jivaVolumesForNode maps a node to the JivaVolumes
+// having controller or replica pods on the node
+func (r *JivaVolumeReconciler) jivaVolumesForNode(obj client.Object) []reconcile.Request {
+	pods := corev1.PodList{}
+	err := r.List(context.TODO(), &pods, client.MatchingFields{podNodeNameField: obj.GetName()})
+	if err != nil {
+		logrus.Errorf("failed to list pods on node %s: %s", obj.GetName(), err.Error())
+		return nil
+	}
+	seen := map[types.NamespacedName]bool{}
+	requests := []reconcile.Request{}
+	for i := range pods.Items {
+		for _, req := range jivaVolumeForPod(&pods.Items[i]) {
+			if seen[req.NamespacedName] {
+				continue
+			}
+			seen[req.NamespacedName] = true
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+func TestJivaVolumeForPod(t *testing.T) {
+	pod := controllerPod("ctrl-a", "10.0.0.1", corev1.PodRunning)
+	reqs := jivaVolumeForPod(pod)
+	if len(reqs) != 1 || reqs[0].Name != "pvc-1" || reqs[0].Namespace != "openebs" {
+		t.Fatalf("jivaVolumeForPod() = %v, want openebs/pvc-1", reqs)
+	}
+
+	pod.Labels["openebs.io/component"] = "app"
+	if reqs := jivaVolumeForPod(pod); len(reqs) != 0 {
+		t.Fatalf("jivaVolumeForPod() = %v, want no requests", reqs)
+	}
+}
+
+func readyNode(status corev1.ConditionStatus) *corev1.Node {
+	return &corev1.Node{
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+		},
+	}
+}
+
+func TestNodeReadinessPredicate(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new *corev1.Node
+		want     bool
+	}{
+		{name: "heartbeat", old: readyNode(corev1.ConditionTrue), new: readyNode(corev1.ConditionTrue), want: false},
+		{name: "not ready", old: readyNode(corev1.ConditionTrue), new: readyNode(corev1.ConditionUnknown), want: true},
+		{name: "ready again", old: readyNode(corev1.ConditionFalse), new: readyNode(corev1.ConditionTrue), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nodeReadinessPredicate.Update(event.UpdateEvent{ObjectOld: tt.old, ObjectNew: tt.new})
+			if got != tt.want {
+				t.Errorf("Update() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJivaVolumePredicate(t *testing.T) {
+	volume := func(generation int64, annotations map[string]string, phase openebsiov1alpha1.JivaVolumePhase) *openebsiov1alpha1.JivaVolume {
+		cr := &openebsiov1alpha1.JivaVolume{}
+		cr.Generation = generation
+		cr.Annotations = annotations
+		cr.Status.Phase = phase
+		return cr
+	}
+	tests := []struct {
+		name     string
+		old, new *openebsiov1alpha1.JivaVolume
+		want     bool
+	}{
+		{
+			name: "status update",
+			old:  volume(1, nil, openebsiov1alpha1.JivaVolumePhaseSyncing),
+			new:  volume(1, nil, openebsiov1alpha1.JivaVolumePhaseReady),
+			want: false,
+		},
+		{
+			name: "spec update",
+			old:  volume(1, nil, openebsiov1alpha1.JivaVolumePhaseReady),
+			new:  volume(2, nil, openebsiov1alpha1.JivaVolumePhaseReady),
+			want: true,
+		},
+		{
+			name: "annotation update",
+			old:  volume(1, nil, openebsiov1alpha1.JivaVolumePhaseReady),
+			new:  volume(1, map[string]string{upgradeRolledBackAnnotation: "3.0.0"}, openebsiov1alpha1.JivaVolumePhaseReady),
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := jivaVolumePredicate.Update(event.UpdateEvent{ObjectOld: tt.old, ObjectNew: tt.new})
+			if got != tt.want {
+				t.Errorf("Update() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+/*
+Copyright © 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// defaultReplicaSC is the storage class used for the replica
+	// PVCs if the volume policy doesn't configure one
+	defaultReplicaSC = "openebs-hostpath"
+	// defaultReplicationFactor is the replication factor used if
+	// the volume policy doesn't configure one
+	defaultReplicationFactor = 3
+	// selectedNodeAnnotation is set on the PVCs of the local
+	// storage classes with the node the PVC is provisioned on
+	selectedNodeAnnotation = "volume.kubernetes.io/selected-node"
+	// hostpathProvisioner is the provisioner of the hostpath storage class
+	hostpathProvisioner = "openebs.io/local"
+	// hostpathCapacityAnnotation and hostpathAvailableAnnotation are set
+	// by the node plugin on its node with the size and the available
+	// space of the filesystem of the hostpath base path in bytes
+	hostpathCapacityAnnotation  = "jiva.openebs.io/hostpath-capacity"
+	hostpathAvailableAnnotation = "jiva.openebs.io/hostpath-available"
+	// hostpathBasePathEnv configures the base path of the hostpath
+	// storage class whose capacity is reported by the node plugin
+	hostpathBasePathEnv     = "HOSTPATH_BASE_PATH"
+	defaultHostpathBasePath = "/var/openebs/local"
+	// hostRootPath is where the root of the host is mounted in the
+	// node plugin container
+	hostRootPath = "/host"
+	// hostpathReportInterval is the interval at which the node
+	// plugin reports the capacity of the hostpath base path
+	hostpathReportInterval = time.Minute
+)
+
+// replicaPlacement keeps the details of the policy which
+// decide where and how many replicas of a volume are placed
+type replicaPlacement struct {
+	storageClass      string
+	replicationFactor int
+	nodeSelector      map[string]string
+}
+
+// getReplicaPlacement returns the replica placement configured in the
+// volume policy passed as the parameter of the storage class
+func (cs *controller) getReplicaPlacement(params map[string]string) (*replicaPlacement, error) {
+	placement := &replicaPlacement{
+		storageClass:      defaultReplicaSC,
+		replicationFactor: defaultReplicationFactor,
+	}
+
+	policyName := params["policy"]
+	if policyName == "" {
+		return placement, nil
+	}
+
+	policy, err := cs.client.GetJivaVolumePolicy(policyName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume policy {%s}, err: {%v}", policyName, err)
+	}
+	if policy.Spec.ReplicaSC != "" {
+		placement.storageClass = policy.Spec.ReplicaSC
+	}
+	if policy.Spec.Target.ReplicationFactor != 0 {
+		placement.replicationFactor = policy.Spec.Target.ReplicationFactor
+	}
+	placement.nodeSelector = policy.Spec.Replica.NodeSelector
+	return placement, nil
+}
+
+// segmentNodes are the nodes a topology segment can
+// place the replicas of a volume on
+type segmentNodes struct {
+	// nodes on which the replicas can be scheduled
+	nodes []corev1.Node
+	// node is the index of the node the segment is
+	// reported for by NodeGetInfo, -1 if it is not
+	// reported for a single node
+	node int
+}
+
+// getSegmentNodes returns the nodes on which the replicas of a volume
+// accessible from the given topology segment can be scheduled. The
+// segments reported by NodeGetInfo carry all the labels of the node
+// along with its name, the other replicas of a volume placed on such
+// a node can be on any node matching the replica node selector.
+func (cs *controller) getSegmentNodes(topology *csi.Topology, placement *replicaPlacement) (*segmentNodes, error) {
+	selector := map[string]string{}
+	for k, v := range placement.nodeSelector {
+		selector[k] = v
+	}
+
+	// the node name key is added by the driver
+	// and is not present in the node labels
+	nodeName, ok := topology.GetSegments()[TopologyNodeKey]
+	if !ok {
+		for k, v := range topology.GetSegments() {
+			selector[k] = v
+		}
+	}
+
+	nodeList, err := cs.client.ListNodes(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	segment := &segmentNodes{node: -1}
+	for _, node := range nodeList.Items {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		if ok && node.Name == nodeName {
+			segment.node = len(segment.nodes)
+		}
+		segment.nodes = append(segment.nodes, node)
+	}
+	return segment, nil
+}
+
+// getNodeCapacities returns the free capacity of the replica storage class
+// on each of the given nodes. The capacity published by the CSI driver of
+// the storage class is used if available. The hostpath storage class has
+// no CSI driver, its capacity on a node is reported by the node plugin as
+// annotations of the node, less the size of the PVCs of the storage class
+// already provisioned on the node.
+func (cs *controller) getNodeCapacities(nodes []corev1.Node, storageClass string) ([]int64, error) {
+	capacities, err := cs.client.ListCSIStorageCapacities(storageClass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage capacities, err: {%v}", err)
+	}
+	if len(capacities) != 0 {
+		result := make([]int64, 0, len(nodes))
+		for _, node := range nodes {
+			free, err := publishedCapacity(capacities, node)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, free)
+		}
+		return result, nil
+	}
+
+	sc, err := cs.client.GetStorageClass(storageClass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage class {%s}, err: {%v}", storageClass, err)
+	}
+	if sc.Provisioner != hostpathProvisioner {
+		return nil, fmt.Errorf("capacity of storage class {%s} is not published by its provisioner {%s}",
+			storageClass, sc.Provisioner)
+	}
+
+	pvcs, err := cs.client.ListPVCsWithStorageClass(storageClass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVCs of storage class {%s}, err: {%v}", storageClass, err)
+	}
+	used := map[string]int64{}
+	for _, pvc := range pvcs {
+		size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		used[pvc.Annotations[selectedNodeAnnotation]] += size.Value()
+	}
+
+	result := make([]int64, 0, len(nodes))
+	for _, node := range nodes {
+		result = append(result, hostpathCapacity(node, used[node.Name]))
+	}
+	return result, nil
+}
+
+// hostpathCapacity returns the free capacity of the hostpath storage class
+// on the node. The PVCs of the storage class are thin provisioned, so the
+// capacity is bounded by both the space available in the filesystem and
+// the space not yet claimed by the PVCs provisioned on the node. The nodes
+// which haven't reported their capacity are taken to have no capacity.
+func hostpathCapacity(node corev1.Node, used int64) int64 {
+	total, err := strconv.ParseInt(node.Annotations[hostpathCapacityAnnotation], 10, 64)
+	if err != nil {
+		return 0
+	}
+	available, err := strconv.ParseInt(node.Annotations[hostpathAvailableAnnotation], 10, 64)
+	if err != nil {
+		return 0
+	}
+	free := total - used
+	if available < free {
+		free = available
+	}
+	if free < 0 {
+		return 0
+	}
+	return free
+}
+
+// publishedCapacity returns the largest capacity published
+// for the topology the given node belongs to
+func publishedCapacity(capacities []unstructured.Unstructured, node corev1.Node) (int64, error) {
+	var free int64
+	for _, item := range capacities {
+		topology, ok, _ := unstructured.NestedMap(item.Object, "nodeTopology")
+		if !ok {
+			continue
+		}
+		labelSelector := &metav1.LabelSelector{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(topology, labelSelector); err != nil {
+			return 0, fmt.Errorf("failed to parse topology of storage capacity {%s}, err: {%v}", item.GetName(), err)
+		}
+		selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+		if err != nil {
+			return 0, fmt.Errorf("invalid topology of storage capacity {%s}, err: {%v}", item.GetName(), err)
+		}
+		if !selector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+
+		value, _, _ := unstructured.NestedString(item.Object, "capacity")
+		if value == "" {
+			continue
+		}
+		capacity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid capacity of storage capacity {%s}, err: {%v}", item.GetName(), err)
+		}
+		if capacity.Value() > free {
+			free = capacity.Value()
+		}
+	}
+	return free, nil
+}
+
+// segmentCapacity returns the size of the largest volume that can be
+// provisioned for the segment given the free capacity of each of its
+// nodes. For a segment of a single node, it is the largest volume which
+// has one of its replicas on that node.
+func segmentCapacity(capacities []int64, node, replicationFactor int) int64 {
+	if node < 0 {
+		return volumeCapacity(capacities, replicationFactor)
+	}
+	if replicationFactor <= 0 {
+		return 0
+	}
+	free := capacities[node]
+	if replicationFactor == 1 {
+		return free
+	}
+	others := make([]int64, 0, len(capacities)-1)
+	others = append(others, capacities[:node]...)
+	others = append(others, capacities[node+1:]...)
+	if rest := volumeCapacity(others, replicationFactor-1); rest < free {
+		return rest
+	}
+	return free
+}
+
+// volumeCapacity returns the size of the largest volume that can be
+// provisioned given the free capacity of each node. As the replicas of
+// a volume are spread across distinct nodes, the size is bounded by the
+// node with the replicationFactor-th largest free capacity.
+func volumeCapacity(capacities []int64, replicationFactor int) int64 {
+	if replicationFactor <= 0 || len(capacities) < replicationFactor {
+		return 0
+	}
+	sorted := append([]int64(nil), capacities...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] > sorted[j]
+	})
+	return sorted[replicationFactor-1]
+}
+
+// reportHostpathCapacity sets the size and the available space of the
+// filesystem of the hostpath base path as annotations of the node, so
+// that the controller plugin can report the capacity of the hostpath
+// storage class. This function runs a never ending loop therefore
+// should be run as a goroutine.
+func (ns *node) reportHostpathCapacity() {
+	basePath := os.Getenv(hostpathBasePathEnv)
+	if basePath == "" {
+		basePath = defaultHostpathBasePath
+	}
+	path := filepath.Join(hostRootPath, basePath)
+	logrus.Infof("Starting reportHostpathCapacity goroutine for {%s}", basePath)
+
+	ticker := time.NewTicker(hostpathReportInterval)
+	defer ticker.Stop()
+	for ; true; <-ticker.C {
+		// the base path is created by the hostpath provisioner
+		// along with the first PVC provisioned on the node
+		if _, err := os.Stat(path); err != nil {
+			logrus.Debugf("reportHostpathCapacity: failed to stat {%s}, err: {%v}", basePath, err)
+			continue
+		}
+		usage, err := getStatistics(path, fsStatistics)
+		if err != nil {
+			logrus.Warningf("reportHostpathCapacity: failed to get statistics of {%s}, err: {%v}", basePath, err)
+			continue
+		}
+		annotations := map[string]string{}
+		for _, u := range usage {
+			if u.Unit == csi.VolumeUsage_BYTES {
+				annotations[hostpathCapacityAnnotation] = strconv.FormatInt(u.Total, 10)
+				annotations[hostpathAvailableAnnotation] = strconv.FormatInt(u.Available, 10)
+			}
+		}
+		if err := ns.client.AnnotateNode(ns.driver.config.NodeID, annotations); err != nil {
+			logrus.Warningf("reportHostpathCapacity: failed to annotate node {%s}, err: {%v}",
+				ns.driver.config.NodeID, err)
+		}
+	}
+}
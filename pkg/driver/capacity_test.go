@@ -0,0 +1,111 @@
+/*
+Copyright © 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVolumeCapacity(t *testing.T) {
+	tests := []struct {
+		name              string
+		capacities        []int64
+		replicationFactor int
+		want              int64
+	}{
+		{name: "single replica", capacities: []int64{10, 30, 20}, replicationFactor: 1, want: 30},
+		{name: "three replicas", capacities: []int64{10, 30, 20, 5}, replicationFactor: 3, want: 10},
+		{name: "not enough nodes", capacities: []int64{10, 30}, replicationFactor: 3, want: 0},
+		{name: "no nodes", capacities: nil, replicationFactor: 1, want: 0},
+		{name: "invalid replication factor", capacities: []int64{10}, replicationFactor: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := volumeCapacity(tt.capacities, tt.replicationFactor); got != tt.want {
+				t.Errorf("volumeCapacity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentCapacity(t *testing.T) {
+	tests := []struct {
+		name              string
+		capacities        []int64
+		node              int
+		replicationFactor int
+		want              int64
+	}{
+		{name: "segment of many nodes", capacities: []int64{10, 30, 20}, node: -1, replicationFactor: 2, want: 20},
+		{name: "single replica on the node", capacities: []int64{10, 30, 20}, node: 0, replicationFactor: 1, want: 10},
+		{name: "node with the least capacity", capacities: []int64{10, 30, 20}, node: 0, replicationFactor: 3, want: 10},
+		{name: "node with the most capacity", capacities: []int64{10, 30, 20, 5}, node: 1, replicationFactor: 3, want: 10},
+		{name: "bounded by the other nodes", capacities: []int64{10, 30, 5}, node: 1, replicationFactor: 2, want: 10},
+		{name: "not enough other nodes", capacities: []int64{10, 30}, node: 1, replicationFactor: 3, want: 0},
+		{name: "invalid replication factor", capacities: []int64{10}, node: 0, replicationFactor: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := segmentCapacity(tt.capacities, tt.node, tt.replicationFactor); got != tt.want {
+				t.Errorf("segmentCapacity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostpathCapacity(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		used        int64
+		want        int64
+	}{
+		{
+			name:        "bounded by the unclaimed space",
+			annotations: map[string]string{hostpathCapacityAnnotation: "100", hostpathAvailableAnnotation: "80"},
+			used:        40,
+			want:        60,
+		},
+		{
+			name:        "bounded by the available space",
+			annotations: map[string]string{hostpathCapacityAnnotation: "100", hostpathAvailableAnnotation: "30"},
+			used:        40,
+			want:        30,
+		},
+		{
+			name:        "over committed",
+			annotations: map[string]string{hostpathCapacityAnnotation: "100", hostpathAvailableAnnotation: "30"},
+			used:        120,
+			want:        0,
+		},
+		{
+			name: "not reported",
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Annotations: tt.annotations}}
+			if got := hostpathCapacity(node, tt.used); got != tt.want {
+				t.Errorf("hostpathCapacity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
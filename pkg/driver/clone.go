@@ -0,0 +1,146 @@
+/*
+Copyright © 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	jv "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/jiva-operator/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// cloneSnapshotPrefix is prefixed to the name of the snapshot taken
+	// on the source volume while cloning a volume from another volume
+	cloneSnapshotPrefix = "clone-"
+)
+
+// getVolumeSource returns the snapshot the data of the requested volume
+// is to be cloned from. If the content source is a volume, a snapshot is
+// taken on it first so that the clone gets a consistent copy of the data.
+func (cs *controller) getVolumeSource(ctx context.Context, req *csi.CreateVolumeRequest) (*jv.VolumeSource, error) {
+	contentSource := req.GetVolumeContentSource()
+	if contentSource == nil {
+		return nil, nil
+	}
+
+	switch {
+	case contentSource.GetSnapshot() != nil:
+		id := contentSource.GetSnapshot().GetSnapshotId()
+		volumeID, snapName, err := parseSnapshotID(id)
+		if err != nil {
+			return nil, status.Errorf(codes.NotFound, "CreateVolume: source snapshot {%s} not found, err: {%v}", id, err)
+		}
+		instance, err := cs.getSourceVolume(req, volumeID)
+		if err != nil {
+			return nil, err
+		}
+		snapshots, err := listVolumeSnapshots(ctx, instance)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal,
+				"CreateVolume: failed to list snapshots of volume {%s}, err: {%v}", volumeID, err)
+		}
+		for _, snap := range snapshots {
+			if snap.SnapshotId == id {
+				return &jv.VolumeSource{SourceVolume: volumeID, Snapshot: snapName}, nil
+			}
+		}
+		return nil, status.Errorf(codes.NotFound, "CreateVolume: source snapshot {%s} not found", id)
+
+	case contentSource.GetVolume() != nil:
+		volumeID := utils.StripName(contentSource.GetVolume().GetVolumeId())
+		if _, err := cs.getSourceVolume(req, volumeID); err != nil {
+			return nil, err
+		}
+		snapName := cloneSnapshotPrefix + utils.StripName(req.GetName())
+		if _, err := cs.createSnapshot(ctx, volumeID, snapName); err != nil {
+			return nil, err
+		}
+		return &jv.VolumeSource{SourceVolume: volumeID, Snapshot: snapName}, nil
+	}
+
+	return nil, status.Error(codes.InvalidArgument, "CreateVolume: unsupported volume content source")
+}
+
+// deleteCloneSnapshot deletes the snapshot taken on the source volume to
+// clone the given volume from it. The snapshot is left as is if the source
+// volume is gone or not Ready, so that the clone can still be deleted.
+func (cs *controller) deleteCloneSnapshot(ctx context.Context, instance *jv.JivaVolume) error {
+	src := instance.Spec.VolumeSource
+	if src == nil || !strings.HasPrefix(src.Snapshot, cloneSnapshotPrefix) {
+		return nil
+	}
+	source, err := cs.client.GetJivaVolume(src.SourceVolume)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return err
+	}
+	if source.Status.Phase != jv.JivaVolumePhaseReady {
+		logrus.Warningf("DeleteVolume: source volume {%s} is not ready, snapshot {%s} is not deleted",
+			src.SourceVolume, src.Snapshot)
+		return nil
+	}
+	cli, err := targetClient(source)
+	if err != nil {
+		return err
+	}
+	disks, err := cli.ListSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := disks[src.Snapshot]; !ok {
+		return nil
+	}
+	if err := cli.DeleteSnapshot(ctx, src.Snapshot); err != nil {
+		return err
+	}
+	logrus.Infof("DeleteVolume: snapshot {%s} of source volume {%s} is deleted", src.Snapshot, src.SourceVolume)
+	return nil
+}
+
+// getSourceVolume fetches the source volume of the clone and verifies
+// that the requested capacity can hold the data of the source volume
+func (cs *controller) getSourceVolume(req *csi.CreateVolumeRequest, volumeID string) (*jv.JivaVolume, error) {
+	instance, err := cs.client.GetJivaVolume(volumeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetCapacityRange() == nil {
+		return instance, nil
+	}
+	capacity, err := resource.ParseQuantity(instance.Spec.Capacity)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"CreateVolume: failed to parse capacity {%s} of source volume {%s}, err: {%v}",
+			instance.Spec.Capacity, volumeID, err)
+	}
+	if req.GetCapacityRange().GetRequiredBytes() < capacity.Value() {
+		return nil, status.Errorf(codes.OutOfRange,
+			"CreateVolume: requested size {%d} is smaller than the size {%s} of source volume {%s}",
+			req.GetCapacityRange().GetRequiredBytes(), instance.Spec.Capacity, volumeID)
+	}
+	return instance, nil
+}
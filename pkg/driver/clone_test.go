@@ -0,0 +1,287 @@
+/*
+Copyright © 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	jv "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/jiva-operator/pkg/kubernetes/client"
+	"github.com/openebs/jiva-operator/pkg/volume"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeTarget serves the REST API of a jiva controller with a single
+// replica in RW mode, the replica API is served by the same server
+type fakeTarget struct {
+	*httptest.Server
+	mu        sync.Mutex
+	snapshots map[string]bool
+	deleted   []string
+}
+
+func newFakeTarget(t *testing.T, snapshots ...string) *fakeTarget {
+	ft := &fakeTarget{snapshots: map[string]bool{}}
+	for _, snap := range snapshots {
+		ft.snapshots[snap] = true
+	}
+	ft.Server = httptest.NewServer(http.HandlerFunc(ft.serve))
+	t.Cleanup(ft.Close)
+
+	_, port, err := net.SplitHostPort(ft.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := targetAPIPort
+	t.Cleanup(func() { targetAPIPort = prev })
+	targetAPIPort = port
+	return ft
+}
+
+func (ft *fakeTarget) serve(w http.ResponseWriter, r *http.Request) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v1/volumes":
+		vol := volume.Volume{Name: "pvc-src"}
+		vol.Actions = map[string]string{
+			"snapshot":       ft.URL + "/v1/volumes/pvc-src/snapshot",
+			"deleteSnapshot": ft.URL + "/v1/volumes/pvc-src/deletesnapshot",
+		}
+		_ = json.NewEncoder(w).Encode(volume.Volumes{Data: []volume.Volume{vol}})
+	case "/v1/replicas":
+		rep := volume.ControllerReplica{Address: "tcp://" + ft.Listener.Addr().String(), Mode: "RW"}
+		_ = json.NewEncoder(w).Encode(volume.ControllerReplicas{Data: []volume.ControllerReplica{rep}})
+	case "/v1/replicas/1":
+		info := volume.ReplicaInfo{Disks: map[string]volume.DiskInfo{}}
+		for snap := range ft.snapshots {
+			info.Disks[snapshotDiskName(snap)] = volume.DiskInfo{UserCreated: true}
+		}
+		_ = json.NewEncoder(w).Encode(info)
+	case "/v1/volumes/pvc-src/snapshot":
+		in := volume.SnapshotInput{}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		ft.snapshots[in.Name] = true
+		out := volume.SnapshotOutput{}
+		out.Id = in.Name
+		_ = json.NewEncoder(w).Encode(out)
+	case "/v1/volumes/pvc-src/deletesnapshot":
+		in := volume.SnapshotInput{}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		delete(ft.snapshots, in.Name)
+		ft.deleted = append(ft.deleted, in.Name)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func snapshotDiskName(snap string) string {
+	return "volume-snap-" + snap + ".img"
+}
+
+func jivaVolume(name string, phase jv.JivaVolumePhase) *jv.JivaVolume {
+	instance := &jv.JivaVolume{}
+	instance.Name = name
+	instance.Namespace = "openebs"
+	instance.Labels = map[string]string{
+		"openebs.io/persistent-volume": name,
+		"openebs.io/component":         "jiva-volume",
+	}
+	instance.Spec.Capacity = "1Gi"
+	instance.Spec.ISCSISpec.TargetIP = "127.0.0.1"
+	instance.Status.Phase = phase
+	return instance
+}
+
+func fakeController(t *testing.T, volumes ...*jv.JivaVolume) *controller {
+	s := runtime.NewScheme()
+	if err := jv.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	builder := fake.NewClientBuilder().WithScheme(s)
+	for _, v := range volumes {
+		builder = builder.WithObjects(v)
+	}
+	return &controller{client: client.NewForClient(builder.Build())}
+}
+
+func TestGetVolumeSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   *csi.VolumeContentSource
+		phase    jv.JivaVolumePhase
+		required int64
+		want     *jv.VolumeSource
+		wantCode codes.Code
+		wantSnap string
+	}{
+		{
+			name: "clone of a volume snapshots the source",
+			source: &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Volume{
+				Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "pvc-src"}}},
+			phase:    jv.JivaVolumePhaseReady,
+			want:     &jv.VolumeSource{SourceVolume: "pvc-src", Snapshot: "clone-pvc-clone"},
+			wantSnap: "clone-pvc-clone",
+		},
+		{
+			name: "clone of a snapshot",
+			source: &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{
+				Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "pvc-src@snap-1"}}},
+			phase: jv.JivaVolumePhaseReady,
+			want:  &jv.VolumeSource{SourceVolume: "pvc-src", Snapshot: "snap-1"},
+		},
+		{
+			name: "clone of a hidden clone snapshot",
+			source: &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{
+				Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "pvc-src@clone-pvc-other"}}},
+			phase:    jv.JivaVolumePhaseReady,
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "clone of a missing snapshot",
+			source: &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{
+				Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "pvc-src@snap-2"}}},
+			phase:    jv.JivaVolumePhaseReady,
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "clone of a volume which is not ready",
+			source: &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Volume{
+				Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "pvc-src"}}},
+			phase:    jv.JivaVolumePhaseSyncing,
+			wantCode: codes.Unavailable,
+		},
+		{
+			name: "clone smaller than the source",
+			source: &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Volume{
+				Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "pvc-src"}}},
+			phase:    jv.JivaVolumePhaseReady,
+			required: 1 << 20,
+			wantCode: codes.OutOfRange,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := newFakeTarget(t, "snap-1", "clone-pvc-other")
+			cs := fakeController(t, jivaVolume("pvc-src", tt.phase))
+			req := &csi.CreateVolumeRequest{Name: "pvc-clone", VolumeContentSource: tt.source}
+			if tt.required > 0 {
+				req.CapacityRange = &csi.CapacityRange{RequiredBytes: tt.required}
+			}
+
+			got, err := cs.getVolumeSource(context.TODO(), req)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("getVolumeSource() error = %v, want code %v", err, tt.wantCode)
+			}
+			if tt.wantCode != codes.OK {
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("getVolumeSource() = %+v, want %+v", got, tt.want)
+			}
+			if tt.wantSnap != "" && !ft.snapshots[tt.wantSnap] {
+				t.Errorf("snapshot %s is not taken on the source, snapshots %v", tt.wantSnap, ft.snapshots)
+			}
+		})
+	}
+}
+
+func TestDeleteCloneSnapshot(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      *jv.VolumeSource
+		phase       jv.JivaVolumePhase
+		noSource    bool
+		wantDeleted []string
+	}{
+		{
+			name:        "clone snapshot is deleted",
+			source:      &jv.VolumeSource{SourceVolume: "pvc-src", Snapshot: "clone-pvc-clone"},
+			phase:       jv.JivaVolumePhaseReady,
+			wantDeleted: []string{"clone-pvc-clone"},
+		},
+		{
+			name:   "user snapshot is kept",
+			source: &jv.VolumeSource{SourceVolume: "pvc-src", Snapshot: "snap-1"},
+			phase:  jv.JivaVolumePhaseReady,
+		},
+		{
+			name:   "clone snapshot already deleted",
+			source: &jv.VolumeSource{SourceVolume: "pvc-src", Snapshot: "clone-pvc-gone"},
+			phase:  jv.JivaVolumePhaseReady,
+		},
+		{
+			name:   "source volume is not ready",
+			source: &jv.VolumeSource{SourceVolume: "pvc-src", Snapshot: "clone-pvc-clone"},
+			phase:  jv.JivaVolumePhaseSyncing,
+		},
+		{
+			name:     "source volume is deleted",
+			source:   &jv.VolumeSource{SourceVolume: "pvc-src", Snapshot: "clone-pvc-clone"},
+			noSource: true,
+		},
+		{
+			name: "volume is not a clone",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := newFakeTarget(t, "snap-1", "clone-pvc-clone")
+			volumes := []*jv.JivaVolume{}
+			if !tt.noSource {
+				volumes = append(volumes, jivaVolume("pvc-src", tt.phase))
+			}
+			cs := fakeController(t, volumes...)
+			clone := jivaVolume("pvc-clone", jv.JivaVolumePhaseReady)
+			clone.Spec.VolumeSource = tt.source
+
+			if err := cs.deleteCloneSnapshot(context.TODO(), clone); err != nil {
+				t.Fatalf("deleteCloneSnapshot() error = %v", err)
+			}
+			if len(ft.deleted) != len(tt.wantDeleted) {
+				t.Fatalf("deleted snapshots = %v, want %v", ft.deleted, tt.wantDeleted)
+			}
+			for i := range ft.deleted {
+				if ft.deleted[i] != tt.wantDeleted[i] {
+					t.Errorf("deleted snapshots = %v, want %v", ft.deleted, tt.wantDeleted)
+				}
+			}
+		})
+	}
+}
+
+func TestListVolumeSnapshotsHidesCloneSnapshots(t *testing.T) {
+	newFakeTarget(t, "snap-1", "clone-pvc-clone")
+	snapshots, err := listVolumeSnapshots(context.TODO(), jivaVolume("pvc-src", jv.JivaVolumePhaseReady))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].SnapshotId != "pvc-src@snap-1" {
+		t.Errorf("listVolumeSnapshots() = %v, want only pvc-src@snap-1", snapshots)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	jv "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/jiva-operator/pkg/utils"
+)
+
+const (
+	// iscsiSessionLoggedIn is the state of the iSCSI session
+	// in sysfs once the initiator has logged in to the target
+	iscsiSessionLoggedIn = "LOGGED_IN"
+)
+
+var (
+	// iscsiSessionPath is the sysfs directory listing
+	// the iSCSI sessions of the node
+	iscsiSessionPath = "/sys/class/iscsi_session"
+)
+
+// getVolumeCondition returns the condition of the volume as seen from the
+// node, the volume is abnormal if the target is not serving IOs in RW mode,
+// any of the replicas has errored, the iSCSI session to the target is not
+// logged in or the volume is mounted read-only.
+func (ns *node) getVolumeCondition(volumeID, volumePath string) *csi.VolumeCondition {
+	instance, err := ns.client.GetJivaVolume(utils.StripName(volumeID))
+	if err != nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("failed to get volume {%s}, err: {%v}", volumeID, err),
+		}
+	}
+
+	var problems []string
+	problems = append(problems, targetProblems(instance)...)
+
+	if state, err := iscsiSessionState(instance.Spec.ISCSISpec.Iqn); err != nil {
+		problems = append(problems, err.Error())
+	} else if state != iscsiSessionLoggedIn {
+		problems = append(problems, fmt.Sprintf("iscsi session state is {%s}", state))
+	}
+
+	if readOnly, err := ns.isMountedReadOnly(volumePath); err != nil {
+		problems = append(problems, err.Error())
+	} else if readOnly {
+		problems = append(problems, "volume is mounted read-only")
+	}
+
+	if len(problems) != 0 {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  strings.Join(problems, ", "),
+		}
+	}
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  "volume is healthy",
+	}
+}
+
+// targetProblems returns the problems with the target and the replicas
+// of the volume as reported in the status of the JivaVolume
+func targetProblems(instance *jv.JivaVolume) []string {
+	var problems []string
+	if instance.Status.Status != "RW" {
+		problems = append(problems, fmt.Sprintf("target mode is {%s}", instance.Status.Status))
+	}
+	for _, rep := range instance.Status.ReplicaStatuses {
+		if rep.Mode == "ERR" {
+			problems = append(problems, fmt.Sprintf("replica {%s} mode is {%s}", rep.Address, rep.Mode))
+		}
+	}
+	return problems
+}
+
+// iscsiSessionState returns the state of the iSCSI session
+// logged in to the target with the given iqn
+func iscsiSessionState(iqn string) (string, error) {
+	sessions, err := filepath.Glob(filepath.Join(iscsiSessionPath, "session*"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list iscsi sessions, err: {%v}", err)
+	}
+
+	for _, session := range sessions {
+		target, err := ioutil.ReadFile(filepath.Join(session, "targetname"))
+		if err != nil || strings.TrimSpace(string(target)) != iqn {
+			continue
+		}
+		state, err := ioutil.ReadFile(filepath.Join(session, "state"))
+		if err != nil {
+			return "", fmt.Errorf("failed to read state of iscsi session {%s}, err: {%v}", filepath.Base(session), err)
+		}
+		return strings.TrimSpace(string(state)), nil
+	}
+	return "", fmt.Errorf("no iscsi session found for target {%s}", iqn)
+}
+
+// isMountedReadOnly returns true if the given path
+// is mounted with the read-only option
+func (ns *node) isMountedReadOnly(path string) (bool, error) {
+	mountPoints, err := ns.mounter.List()
+	if err != nil {
+		return false, fmt.Errorf("failed to list mount points, err: {%v}", err)
+	}
+	for _, mp := range mountPoints {
+		if mp.Path != path {
+			continue
+		}
+		for _, opt := range mp.Opts {
+			if opt == "ro" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, nil
+}
@@ -18,17 +18,16 @@ package driver
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	jv "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
-	"github.com/openebs/jiva-operator/pkg/jiva"
 	"github.com/openebs/jiva-operator/pkg/kubernetes/client"
 	analytics "github.com/openebs/jiva-operator/pkg/usage"
 	"github.com/openebs/jiva-operator/pkg/utils"
-	"github.com/openebs/jiva-operator/pkg/volume"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
@@ -60,6 +59,7 @@ var SupportedVolumeCapabilityAccessType = []*csi.VolumeCapability_Mount{
 }
 
 var (
+	httpReqTimeout       = 30 * time.Second
 	httpReqRetryCount    = 5
 	httpReqRetryInterval = 2 * time.Second
 )
@@ -92,7 +92,12 @@ func (cs *controller) CreateVolume(
 		return nil, status.Errorf(codes.Internal, "DeleteVolume: failed to set client, err: {%v}", err)
 	}
 
-	if volumeID, err = cs.client.CreateJivaVolume(req); err != nil {
+	src, err := cs.getVolumeSource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if volumeID, err = cs.client.CreateJivaVolume(req, src); err != nil {
 		return nil, err
 	}
 	if _, ok := req.GetParameters()["wait"]; ok {
@@ -119,6 +124,7 @@ func (cs *controller) CreateVolume(
 		Volume: &csi.Volume{
 			VolumeId:      volumeID,
 			CapacityBytes: req.GetCapacityRange().GetRequiredBytes(),
+			ContentSource: req.GetVolumeContentSource(),
 		},
 	}, nil
 }
@@ -154,6 +160,13 @@ func (cs *controller) DeleteVolume(
 
 	}
 
+	// the snapshot is needed by the clone till it is deleted, as
+	// the replicas of the clone are rebuilt from it on restarts
+	if err = cs.deleteCloneSnapshot(ctx, jv); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"DeleteVolume: failed to delete clone snapshot of volume {%v}, err: {%v}", req.VolumeId, err)
+	}
+
 	if err = cs.client.DeleteJivaVolume(volID); err != nil {
 		return nil, status.Errorf(codes.Internal, "DeleteVolume: failed to delete volume {%v}, err: {%v}", req.VolumeId, err)
 	}
@@ -287,31 +300,9 @@ func (cs *controller) ControllerExpandVolume(
 	}
 
 	updatedSize := req.GetCapacityRange().GetRequiredBytes()
-	vol := volume.Volumes{}
-	ctrlIP := jivaVolume.Spec.ISCSISpec.TargetIP
-	if len(ctrlIP) == 0 {
-		return nil, status.Errorf(codes.Internal, "Target IP is nil")
-	}
-
-	cli := jiva.NewControllerClient(jivaVolume.Spec.ISCSISpec.TargetIP + ":9501")
-	cli.SetTimeout(30 * time.Second)
-	retryCount := 0
-	var httpErr error
-	for retryCount < httpReqRetryCount {
-		httpErr = cli.Get("/volumes", &vol)
-		if httpErr == nil {
-			break
-		}
-		time.Sleep(httpReqRetryInterval)
-		retryCount++
-	}
-
-	if httpErr != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to get volume info from jiva controller, err: %v", httpErr)
-	}
-
-	if len(vol.Data) == 0 {
-		return nil, status.Error(codes.Internal, "Failed to get volume info, no volume found")
+	cli, err := targetClient(jivaVolume)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
 	}
 
 	size := resource.NewQuantity(updatedSize, resource.BinarySI)
@@ -321,24 +312,8 @@ func (cs *controller) ControllerExpandVolume(
 	}
 	capacity := fmt.Sprintf("%dGi", volSizeGiB)
 
-	input := volume.ResizeInput{
-		Name: vol.Data[0].Name,
-		Size: capacity,
-	}
-
-	retryCount = 0
-	for retryCount < httpReqRetryCount {
-		httpErr = cli.Post(vol.Data[0].Actions["resize"], input, nil)
-		if httpErr == nil || strings.Contains(httpErr.Error(), "Volume size same as size mentioned") {
-			httpErr = nil
-			break
-		}
-		time.Sleep(httpReqRetryInterval)
-		retryCount++
-	}
-
-	if httpErr != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to post resize request to jiva controller, err: %v", httpErr)
+	if err := cli.ResizeVolume(ctx, capacity); err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to resize volume on jiva controller, err: %v", err)
 	}
 
 	// set client each time to avoid caching issue
@@ -375,7 +350,27 @@ func (cs *controller) CreateSnapshot(
 	req *csi.CreateSnapshotRequest,
 ) (*csi.CreateSnapshotResponse, error) {
 
-	return nil, status.Error(codes.Unimplemented, "")
+	if err := cs.validateSnapshotCreateReq(req); err != nil {
+		return nil, err
+	}
+
+	volumeID := utils.StripName(req.GetSourceVolumeId())
+	snapName := req.GetName()
+
+	// set client each time to avoid caching issue
+	if err := cs.client.Set(); err != nil {
+		return nil, status.Errorf(codes.Internal, "CreateSnapshot: failed to set client, err: {%v}", err)
+	}
+
+	snap, err := cs.createSnapshot(ctx, volumeID, snapName)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("CreateSnapshot: snapshot {%s} of volume {%s} is created", snapName, volumeID)
+	return &csi.CreateSnapshotResponse{
+		Snapshot: snap,
+	}, nil
 }
 
 // DeleteSnapshot deletes given snapshot
@@ -386,7 +381,59 @@ func (cs *controller) DeleteSnapshot(
 	req *csi.DeleteSnapshotRequest,
 ) (*csi.DeleteSnapshotResponse, error) {
 
-	return nil, status.Error(codes.Unimplemented, "")
+	if req.GetSnapshotId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "DeleteSnapshot: snapshot id not provided")
+	}
+
+	volumeID, snapName, err := parseSnapshotID(req.GetSnapshotId())
+	if err != nil {
+		// snapshot with an invalid id can't exist, so
+		// there is nothing to delete
+		logrus.Warningf("DeleteSnapshot: %v, ignore deletion...", err)
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+
+	// set client each time to avoid caching issue
+	if err := cs.client.Set(); err != nil {
+		return nil, status.Errorf(codes.Internal, "DeleteSnapshot: failed to set client, err: {%v}", err)
+	}
+
+	instance, err := cs.client.GetJivaVolume(volumeID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return &csi.DeleteSnapshotResponse{}, nil
+		}
+		return nil, err
+	}
+
+	snapshots, err := listVolumeSnapshots(ctx, instance)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"DeleteSnapshot: failed to list snapshots of volume {%s}, err: {%v}", volumeID, err)
+	}
+
+	found := false
+	for _, snap := range snapshots {
+		if snap.SnapshotId == req.GetSnapshotId() {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+
+	cli, err := targetClient(instance)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if err := cli.DeleteSnapshot(ctx, snapName); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"DeleteSnapshot: failed to delete snapshot {%s} of volume {%s}, err: {%v}", snapName, volumeID, err)
+	}
+
+	logrus.Infof("DeleteSnapshot: snapshot {%s} of volume {%s} is deleted", snapName, volumeID)
+	return &csi.DeleteSnapshotResponse{}, nil
 }
 
 // ListSnapshots lists all snapshots for the
@@ -398,7 +445,31 @@ func (cs *controller) ListSnapshots(
 	req *csi.ListSnapshotsRequest,
 ) (*csi.ListSnapshotsResponse, error) {
 
-	return nil, status.Error(codes.Unimplemented, "")
+	// set client each time to avoid caching issue
+	if err := cs.client.Set(); err != nil {
+		return nil, status.Errorf(codes.Internal, "ListSnapshots: failed to set client, err: {%v}", err)
+	}
+
+	snapshots, err := cs.listSnapshots(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, next, err := paginate(len(snapshots), req.GetStartingToken(), req.GetMaxEntries())
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*csi.ListSnapshotsResponse_Entry, 0, end-start)
+	for _, snap := range snapshots[start:end] {
+		entries = append(entries, &csi.ListSnapshotsResponse_Entry{
+			Snapshot: snap,
+		})
+	}
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries,
+		NextToken: next,
+	}, nil
 }
 
 // ControllerUnpublishVolume removes a previously
@@ -425,8 +496,8 @@ func (cs *controller) ControllerPublishVolume(
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
-// GetCapacity return the capacity of the
-// given volume
+// GetCapacity returns the capacity available for provisioning
+// the volumes in the given topology segment
 //
 // This implements csi.ControllerServer
 func (cs *controller) GetCapacity(
@@ -434,7 +505,34 @@ func (cs *controller) GetCapacity(
 	req *csi.GetCapacityRequest,
 ) (*csi.GetCapacityResponse, error) {
 
-	return nil, status.Error(codes.Unimplemented, "")
+	// set client each time to avoid caching issue
+	if err := cs.client.Set(); err != nil {
+		return nil, status.Errorf(codes.Internal, "GetCapacity: failed to set client, err: {%v}", err)
+	}
+
+	placement, err := cs.getReplicaPlacement(req.GetParameters())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "GetCapacity: %v", err)
+	}
+
+	segment, err := cs.getSegmentNodes(req.GetAccessibleTopology(), placement)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "GetCapacity: failed to list nodes, err: {%v}", err)
+	}
+	// the node of the segment can't host the replicas
+	// if it doesn't match the replica node selector
+	if len(req.GetAccessibleTopology().GetSegments()[TopologyNodeKey]) != 0 && segment.node < 0 {
+		return &csi.GetCapacityResponse{}, nil
+	}
+
+	capacities, err := cs.getNodeCapacities(segment.nodes, placement.storageClass)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "GetCapacity: %v", err)
+	}
+
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: segmentCapacity(capacities, segment.node, placement.replicationFactor),
+	}, nil
 }
 
 // ListVolumes lists all the volumes
@@ -445,9 +543,81 @@ func (cs *controller) ListVolumes(
 	req *csi.ListVolumesRequest,
 ) (*csi.ListVolumesResponse, error) {
 
+	// set client each time to avoid caching issue
+	if err := cs.client.Set(); err != nil {
+		return nil, status.Errorf(codes.Internal, "ListVolumes: failed to set client, err: {%v}", err)
+	}
+
+	vols, err := cs.client.ListJivaVolumeWithOpts(map[string]string{
+		"openebs.io/component": "jiva-volume",
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ListVolumes: failed to list volumes, err: {%v}", err)
+	}
+
+	// sort the volumes so that the starting token
+	// refers to the same entry across the calls
+	sort.Slice(vols.Items, func(i, j int) bool {
+		return vols.Items[i].Name < vols.Items[j].Name
+	})
+
+	start, end, next, err := paginate(len(vols.Items), req.GetStartingToken(), req.GetMaxEntries())
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, end-start)
+	for i := range vols.Items[start:end] {
+		instance := &vols.Items[start+i]
+		capacity, err := resource.ParseQuantity(instance.Spec.Capacity)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal,
+				"ListVolumes: failed to parse capacity {%s} of volume {%s}, err: {%v}",
+				instance.Spec.Capacity, instance.Name, err)
+		}
+		entries = append(entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      instance.Name,
+				CapacityBytes: capacity.Value(),
+			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				VolumeCondition: volumeCondition(instance),
+			},
+		})
+	}
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: next,
+	}, nil
+}
+
+// ControllerGetVolume fetches the given volume
+//
+// This implements csi.ControllerServer
+func (cs *controller) ControllerGetVolume(
+	ctx context.Context,
+	req *csi.ControllerGetVolumeRequest,
+) (*csi.ControllerGetVolumeResponse, error) {
+
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
+// volumeCondition returns the condition of the volume, the volume
+// is abnormal if it is not ready to serve the IOs
+func volumeCondition(instance *jv.JivaVolume) *csi.VolumeCondition {
+	if instance.Status.Phase != jv.JivaVolumePhaseReady {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message: fmt.Sprintf("volume is not ready, phase: {%s}, status: {%s}",
+				instance.Status.Phase, instance.Status.Status),
+		}
+	}
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  "volume is ready",
+	}
+}
+
 // IsSupportedVolumeCapabilityAccessMode valides the requested access mode
 func IsSupportedVolumeCapabilityAccessMode(
 	accessMode csi.VolumeCapability_AccessMode_Mode,
@@ -480,6 +650,12 @@ func newControllerCapabilities() []*csi.ControllerServiceCapability {
 	for _, cap := range []csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+		csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
 	} {
 		capabilities = append(capabilities, fromType(cap))
 	}
@@ -72,6 +72,7 @@ func New(config *config.Config, cli *client.Client) *CSIDriver {
 
 	case "node":
 		ns := NewNode(driver, cli)
+		go ns.reportHostpathCapacity()
 		remount := os.Getenv("REMOUNT")
 		if remount == "true" || remount == "True" {
 			nm := newNodeMounterWithOpts(
@@ -62,6 +62,9 @@ var (
 	// MaxRetryCount is the retry count to check if volume is ready during
 	// nodeStage RPC call
 	MaxRetryCount int
+	// StatsTimeout is the max time to wait for the filesystem
+	// statistics of a volume during NodeGetVolumeStats RPC call
+	StatsTimeout = 10 * time.Second
 )
 
 var (
@@ -70,6 +73,7 @@ var (
 		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
 		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
 		csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+		csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
 	}
 )
 
@@ -615,6 +619,7 @@ func (ns *node) NodeUnpublishVolume(
 	if err := ns.unmount(volumeID, target); err != nil {
 		return nil, err
 	}
+	forgetStatistics(target)
 
 update:
 	instance, err := doesVolumeExist(volumeID, ns.client)
@@ -834,40 +839,25 @@ func (ns *node) NodeGetVolumeStats(
 		return nil, status.Error(codes.InvalidArgument, "Volume Path must be provided")
 	}
 
-	mounted, err := ns.mounter.ExistsPath(volumePath)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to check if volume path {%q} is mounted: %s", volumePath, err)
-	}
-
-	if !mounted {
-		return nil, status.Errorf(codes.NotFound, "Volume path {%q} is not mounted", volumePath)
-	}
-
-	isBlock, err := IsBlockDevice(volumePath)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to determine whether %s is block device: %v", req.VolumePath, err)
-	}
-	if isBlock {
-		bcap, err := ns.getBlockSizeBytes(volumePath)
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to get block capacity on path %s: %v", req.VolumePath, err)
-		}
+	stats, err := getStatistics(volumePath, ns.volumeStatistics)
+	if err == errStatsTimeout {
+		// the filesystem is not responding, return the last known
+		// statistics instead of blocking the kubelet
+		logrus.Warningf("NodeGetVolumeStats: statfs on volume path {%q} timed out after %v", volumePath, StatsTimeout)
 		return &csi.NodeGetVolumeStatsResponse{
-			Usage: []*csi.VolumeUsage{
-				{
-					Unit:  csi.VolumeUsage_BYTES,
-					Total: bcap,
-				},
+			Usage: stats,
+			VolumeCondition: &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  fmt.Sprintf("filesystem statistics timed out after %v, volume may be unresponsive", StatsTimeout),
 			},
 		}, nil
 	}
-
-	stats, err := getStatistics(volumePath)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to retrieve capacity statistics for volume path {%q}: {%s}", volumePath, err)
+		return nil, err
 	}
 
 	return &csi.NodeGetVolumeStatsResponse{
-		Usage: stats,
+		Usage:           stats,
+		VolumeCondition: ns.getVolumeCondition(volumeID, volumePath),
 	}, nil
 }
@@ -0,0 +1,284 @@
+/*
+Copyright © 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes"
+	jv "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/jiva-operator/pkg/jiva"
+	"github.com/openebs/jiva-operator/pkg/utils"
+	"github.com/openebs/jiva-operator/pkg/volume"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// snapshotIDSeparator separates the volume name and the snapshot
+	// name in the snapshot id i.e. <volume>@<snapshot>
+	snapshotIDSeparator = "@"
+)
+
+// snapshotID returns the id of the snapshot which encodes the
+// volume the snapshot belongs to
+func snapshotID(volumeID, snapName string) string {
+	return volumeID + snapshotIDSeparator + snapName
+}
+
+// parseSnapshotID returns the volume and snapshot name
+// encoded in the snapshot id
+func parseSnapshotID(id string) (string, string, error) {
+	parts := strings.Split(id, snapshotIDSeparator)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid snapshot id {%s}, expected <volume>%s<snapshot>", id, snapshotIDSeparator)
+	}
+	return parts[0], parts[1], nil
+}
+
+// targetAPIPort is the port of the REST API of the jiva controller
+var targetAPIPort = "9501"
+
+// targetClient returns the client to interact with the jiva
+// controller of the given volume
+func targetClient(instance *jv.JivaVolume) (*jiva.ControllerClient, error) {
+	if len(instance.Spec.ISCSISpec.TargetIP) == 0 {
+		return nil, fmt.Errorf("target IP of volume {%s} is empty", instance.Name)
+	}
+	return jiva.NewControllerClient(instance.Spec.ISCSISpec.TargetIP+":"+targetAPIPort,
+		jiva.WithTimeout(httpReqTimeout),
+		jiva.WithRetries(httpReqRetryCount, httpReqRetryInterval)), nil
+}
+
+// newCSISnapshot converts the snapshot disk info fetched from the
+// replica into the CSI snapshot
+func newCSISnapshot(volumeID, snapName string, disk volume.DiskInfo) *csi.Snapshot {
+	snap := &csi.Snapshot{
+		SnapshotId:     snapshotID(volumeID, snapName),
+		SourceVolumeId: volumeID,
+		ReadyToUse:     true,
+	}
+	if size, err := strconv.ParseInt(disk.Size, 10, 64); err == nil {
+		snap.SizeBytes = size
+	}
+	created, err := time.Parse(time.RFC3339, disk.Created)
+	if err != nil {
+		created = time.Now()
+	}
+	snap.CreationTime, _ = ptypes.TimestampProto(created)
+	return snap
+}
+
+// listVolumeSnapshots returns the CSI snapshots of the given volume
+// sorted by snapshot id, the snapshots taken by the driver to clone
+// the volume are left out as they are deleted along with the clone
+func listVolumeSnapshots(ctx context.Context, instance *jv.JivaVolume) ([]*csi.Snapshot, error) {
+	cli, err := targetClient(instance)
+	if err != nil {
+		return nil, err
+	}
+	disks, err := cli.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*csi.Snapshot, 0, len(disks))
+	for name, disk := range disks {
+		if strings.HasPrefix(name, cloneSnapshotPrefix) {
+			continue
+		}
+		snapshots = append(snapshots, newCSISnapshot(instance.Name, name, disk))
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].SnapshotId < snapshots[j].SnapshotId
+	})
+	return snapshots, nil
+}
+
+// paginate returns the range of entries to be returned for the given
+// starting token and max entries, along with the next token
+func paginate(total int, startingToken string, maxEntries int32) (int, int, string, error) {
+	if maxEntries < 0 {
+		return 0, 0, "", status.Errorf(codes.InvalidArgument, "invalid max entries: %d", maxEntries)
+	}
+
+	start := 0
+	if startingToken != "" {
+		i, err := strconv.Atoi(startingToken)
+		if err != nil || i < 0 || i > total {
+			return 0, 0, "", status.Errorf(codes.Aborted, "invalid starting token: {%s}", startingToken)
+		}
+		start = i
+	}
+
+	end := total
+	if maxEntries > 0 && start+int(maxEntries) < total {
+		end = start + int(maxEntries)
+	}
+
+	next := ""
+	if end < total {
+		next = strconv.Itoa(end)
+	}
+	return start, end, next, nil
+}
+
+func (cs *controller) validateSnapshotCreateReq(req *csi.CreateSnapshotRequest) error {
+	if req.GetName() == "" {
+		return status.Error(codes.InvalidArgument,
+			"Failed to validate snapshot create request: missing snapshot name")
+	}
+	if req.GetSourceVolumeId() == "" {
+		return status.Error(codes.InvalidArgument,
+			"Failed to validate snapshot create request: missing source volume id")
+	}
+	if strings.Contains(req.GetName(), snapshotIDSeparator) {
+		return status.Errorf(codes.InvalidArgument,
+			"Failed to validate snapshot create request: snapshot name must not contain {%s}", snapshotIDSeparator)
+	}
+	if strings.HasPrefix(req.GetName(), cloneSnapshotPrefix) {
+		return status.Errorf(codes.InvalidArgument,
+			"Failed to validate snapshot create request: snapshot name must not start with {%s}", cloneSnapshotPrefix)
+	}
+	return nil
+}
+
+// createSnapshot takes the snapshot of the volume if the snapshot with the
+// given name doesn't exist yet, so that retries of the request from the CO
+// don't end up creating multiple snapshots.
+func (cs *controller) createSnapshot(ctx context.Context, volumeID, snapName string) (*csi.Snapshot, error) {
+	instance, err := cs.client.GetJivaVolume(volumeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if instance.Status.Phase != jv.JivaVolumePhaseReady {
+		return nil, status.Errorf(codes.Unavailable,
+			"CreateSnapshot: volume {%s} is not ready, phase: {%s}", volumeID, instance.Status.Phase)
+	}
+
+	cli, err := targetClient(instance)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	disks, err := cli.ListSnapshots(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"CreateSnapshot: failed to list snapshots of volume {%s}, err: {%v}", volumeID, err)
+	}
+	if disk, ok := disks[snapName]; ok {
+		return newCSISnapshot(volumeID, snapName, disk), nil
+	}
+
+	if _, err := cli.CreateSnapshot(ctx, snapName); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"CreateSnapshot: failed to create snapshot {%s} of volume {%s}, err: {%v}", snapName, volumeID, err)
+	}
+
+	disks, err = cli.ListSnapshots(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"CreateSnapshot: failed to list snapshots of volume {%s}, err: {%v}", volumeID, err)
+	}
+	disk, ok := disks[snapName]
+	if !ok {
+		return nil, status.Errorf(codes.Internal,
+			"CreateSnapshot: snapshot {%s} of volume {%s} not found after creation", snapName, volumeID)
+	}
+	return newCSISnapshot(volumeID, snapName, disk), nil
+}
+
+// listSnapshots returns the snapshots matching the filters
+// in the list request
+func (cs *controller) listSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) ([]*csi.Snapshot, error) {
+	if req.GetSnapshotId() != "" {
+		volumeID, _, err := parseSnapshotID(req.GetSnapshotId())
+		if err != nil {
+			// no snapshot can exist with an invalid id
+			return nil, nil
+		}
+		if req.GetSourceVolumeId() != "" && utils.StripName(req.GetSourceVolumeId()) != volumeID {
+			return nil, nil
+		}
+		instance, err := cs.client.GetJivaVolume(volumeID)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil, nil
+			}
+			return nil, err
+		}
+		snapshots, err := listVolumeSnapshots(ctx, instance)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal,
+				"ListSnapshots: failed to list snapshots of volume {%s}, err: {%v}", volumeID, err)
+		}
+		for _, snap := range snapshots {
+			if snap.SnapshotId == req.GetSnapshotId() {
+				return []*csi.Snapshot{snap}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	if req.GetSourceVolumeId() != "" {
+		volumeID := utils.StripName(req.GetSourceVolumeId())
+		instance, err := cs.client.GetJivaVolume(volumeID)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil, nil
+			}
+			return nil, err
+		}
+		snapshots, err := listVolumeSnapshots(ctx, instance)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal,
+				"ListSnapshots: failed to list snapshots of volume {%s}, err: {%v}", volumeID, err)
+		}
+		return snapshots, nil
+	}
+
+	vols, err := cs.client.ListJivaVolumeWithOpts(map[string]string{
+		"openebs.io/component": "jiva-volume",
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ListSnapshots: failed to list volumes, err: {%v}", err)
+	}
+
+	var snapshots []*csi.Snapshot
+	for i := range vols.Items {
+		instance := &vols.Items[i]
+		if instance.Status.Phase != jv.JivaVolumePhaseReady {
+			continue
+		}
+		snaps, err := listVolumeSnapshots(ctx, instance)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal,
+				"ListSnapshots: failed to list snapshots of volume {%s}, err: {%v}", instance.Name, err)
+		}
+		snapshots = append(snapshots, snaps...)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].SnapshotId < snapshots[j].SnapshotId
+	})
+	return snapshots, nil
+}
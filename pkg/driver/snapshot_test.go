@@ -0,0 +1,100 @@
+/*
+Copyright © 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import "testing"
+
+func TestParseSnapshotID(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		volume   string
+		snapshot string
+		wantErr  bool
+	}{
+		{
+			name:     "valid snapshot id",
+			id:       "pvc-1234@snapshot-5678",
+			volume:   "pvc-1234",
+			snapshot: "snapshot-5678",
+		},
+		{
+			name:    "missing separator",
+			id:      "pvc-1234",
+			wantErr: true,
+		},
+		{
+			name:    "missing snapshot name",
+			id:      "pvc-1234@",
+			wantErr: true,
+		},
+		{
+			name:    "multiple separators",
+			id:      "pvc-1234@snap@shot",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volume, snapshot, err := parseSnapshotID(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSnapshotID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if volume != tt.volume || snapshot != tt.snapshot {
+				t.Errorf("parseSnapshotID() = %v, %v, want %v, %v", volume, snapshot, tt.volume, tt.snapshot)
+			}
+			if !tt.wantErr && snapshotID(volume, snapshot) != tt.id {
+				t.Errorf("snapshotID() = %v, want %v", snapshotID(volume, snapshot), tt.id)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name       string
+		total      int
+		token      string
+		maxEntries int32
+		start, end int
+		next       string
+		wantErr    bool
+	}{
+		{name: "all entries", total: 5, start: 0, end: 5},
+		{name: "first page", total: 5, maxEntries: 2, start: 0, end: 2, next: "2"},
+		{name: "middle page", total: 5, token: "2", maxEntries: 2, start: 2, end: 4, next: "4"},
+		{name: "last page", total: 5, token: "4", maxEntries: 2, start: 4, end: 5},
+		{name: "no entries", total: 0, start: 0, end: 0},
+		{name: "invalid token", total: 5, token: "abc", wantErr: true},
+		{name: "token out of range", total: 5, token: "6", wantErr: true},
+		{name: "negative max entries", total: 5, maxEntries: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, next, err := paginate(tt.total, tt.token, tt.maxEntries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("paginate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if start != tt.start || end != tt.end || next != tt.next {
+				t.Errorf("paginate() = %v, %v, %q, want %v, %v, %q", start, end, next, tt.start, tt.end, tt.next)
+			}
+		})
+	}
+}
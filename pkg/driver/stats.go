@@ -17,20 +17,164 @@ limitations under the License.
 package driver
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-func getStatistics(volumePath string) ([]*csi.VolumeUsage, error) {
+const (
+	// statsCacheTTL is the time for which the last known statistics
+	// of a volume are reported while its filesystem is not responding
+	statsCacheTTL = 5 * time.Minute
+)
+
+var (
+	// errStatsTimeout is returned if the statfs of the volume
+	// doesn't complete within the StatsTimeout
+	errStatsTimeout = errors.New("timed out while fetching filesystem statistics")
+
+	volumeStats = &statsCache{
+		entries: map[string]*statsEntry{},
+	}
+)
+
+// statsCache keeps the last known statistics of the volumes so that
+// they can be reported while the filesystem is not responding
+type statsCache struct {
+	sync.Mutex
+	entries map[string]*statsEntry
+}
+
+type statsEntry struct {
+	usage []*csi.VolumeUsage
+	// updated is the time the usage was fetched at
+	updated time.Time
+	// inProgress is set while a statfs is running on the volume
+	// path, at most one statfs is run at a time for a path since
+	// a hung statfs can't be cancelled
+	inProgress bool
+}
+
+// cached returns the last known statistics unless they are
+// older than statsCacheTTL, the cache must be locked
+func (e *statsEntry) cached() []*csi.VolumeUsage {
+	if time.Since(e.updated) > statsCacheTTL {
+		return nil
+	}
+	return e.usage
+}
+
+// getStatistics returns the statistics of the given volume path fetched
+// by the given function. If it doesn't complete within the StatsTimeout,
+// the last known statistics, if fetched within statsCacheTTL, are
+// returned along with errStatsTimeout.
+func getStatistics(volumePath string,
+	statistics func(string) ([]*csi.VolumeUsage, error)) ([]*csi.VolumeUsage, error) {
+	volumeStats.Lock()
+	entry, ok := volumeStats.entries[volumePath]
+	if !ok {
+		entry = &statsEntry{}
+		volumeStats.entries[volumePath] = entry
+	}
+	if entry.inProgress {
+		usage := entry.cached()
+		volumeStats.Unlock()
+		return usage, errStatsTimeout
+	}
+	entry.inProgress = true
+	volumeStats.Unlock()
+
+	type result struct {
+		usage []*csi.VolumeUsage
+		err   error
+	}
+	// buffered so that the worker doesn't block if the
+	// caller has already returned due to the timeout
+	ch := make(chan result, 1)
+	go func() {
+		usage, err := statistics(volumePath)
+		volumeStats.Lock()
+		entry.inProgress = false
+		if err == nil {
+			entry.usage = usage
+			entry.updated = time.Now()
+		}
+		volumeStats.Unlock()
+		ch <- result{usage: usage, err: err}
+	}()
+
+	timer := time.NewTimer(StatsTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-ch:
+		return res.usage, res.err
+	case <-timer.C:
+		volumeStats.Lock()
+		usage := entry.cached()
+		volumeStats.Unlock()
+		return usage, errStatsTimeout
+	}
+}
+
+// forgetStatistics removes the cached statistics of the volume path
+func forgetStatistics(volumePath string) {
+	volumeStats.Lock()
+	defer volumeStats.Unlock()
+	if entry, ok := volumeStats.entries[volumePath]; ok && !entry.inProgress {
+		delete(volumeStats.entries, volumePath)
+	}
+}
+
+// volumeStatistics returns the statistics of the volume published at the
+// given path. All the calls which touch the path are made here, as they
+// can hang just like the statfs if the iSCSI target is not reachable.
+func (ns *node) volumeStatistics(volumePath string) ([]*csi.VolumeUsage, error) {
+	mounted, err := ns.mounter.ExistsPath(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to check if volume path {%q} is mounted: %s", volumePath, err)
+	}
+	if !mounted {
+		return nil, status.Errorf(codes.NotFound, "Volume path {%q} is not mounted", volumePath)
+	}
+
+	isBlock, err := IsBlockDevice(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to determine whether %s is block device: %v", volumePath, err)
+	}
+	if isBlock {
+		bcap, err := ns.getBlockSizeBytes(volumePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to get block capacity on path %s: %v", volumePath, err)
+		}
+		return []*csi.VolumeUsage{
+			{
+				Unit:  csi.VolumeUsage_BYTES,
+				Total: bcap,
+			},
+		}, nil
+	}
+
+	usage, err := fsStatistics(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to retrieve capacity statistics for volume path {%q}: {%s}", volumePath, err)
+	}
+	return usage, nil
+}
+
+func fsStatistics(volumePath string) ([]*csi.VolumeUsage, error) {
 	var statfs unix.Statfs_t
 	// See http://man7.org/linux/man-pages/man2/statfs.2.html for details.
-	// TODO:
-	// This syscall may hang under some situations, need to find some way
-	// to cancel the execution of this function
+	// This syscall may hang under some situations, e.g. if the iSCSI
+	// target is not reachable, so it's always run with a timeout by
+	// getStatistics
 	err := unix.Statfs(volumePath, &statfs)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,174 @@
+/*
+Copyright © 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func setStatsTimeout(t *testing.T, timeout time.Duration) {
+	prev := StatsTimeout
+	t.Cleanup(func() { StatsTimeout = prev })
+	StatsTimeout = timeout
+}
+
+func usageOf(total int64) []*csi.VolumeUsage {
+	return []*csi.VolumeUsage{{Unit: csi.VolumeUsage_BYTES, Total: total}}
+}
+
+func TestGetStatistics(t *testing.T) {
+	setStatsTimeout(t, 50*time.Millisecond)
+
+	tests := []struct {
+		name      string
+		cached    []*csi.VolumeUsage
+		cachedAt  time.Time
+		blocked   bool
+		wantTotal int64
+		wantErr   error
+	}{
+		{
+			name:      "statistics are fetched",
+			wantTotal: 10,
+		},
+		{
+			name:    "blocked statfs without cached statistics",
+			blocked: true,
+			wantErr: errStatsTimeout,
+		},
+		{
+			name:      "blocked statfs returns the cached statistics",
+			cached:    usageOf(5),
+			cachedAt:  time.Now(),
+			blocked:   true,
+			wantTotal: 5,
+			wantErr:   errStatsTimeout,
+		},
+		{
+			name:     "blocked statfs doesn't return the expired statistics",
+			cached:   usageOf(5),
+			cachedAt: time.Now().Add(-statsCacheTTL - time.Second),
+			blocked:  true,
+			wantErr:  errStatsTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("/stats-test", t.Name())
+			t.Cleanup(func() { forgetStatistics(path) })
+			if tt.cached != nil {
+				volumeStats.Lock()
+				volumeStats.entries[path] = &statsEntry{usage: tt.cached, updated: tt.cachedAt}
+				volumeStats.Unlock()
+			}
+			release := make(chan struct{})
+			statistics := func(string) ([]*csi.VolumeUsage, error) {
+				if tt.blocked {
+					<-release
+				}
+				return usageOf(10), nil
+			}
+
+			start := time.Now()
+			usage, err := getStatistics(path, statistics)
+			elapsed := time.Since(start)
+			if err != tt.wantErr {
+				t.Fatalf("getStatistics() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantTotal == 0 && usage != nil {
+				t.Errorf("getStatistics() = %v, want no statistics", usage)
+			}
+			if tt.wantTotal != 0 && (len(usage) != 1 || usage[0].Total != tt.wantTotal) {
+				t.Errorf("getStatistics() = %v, want total %d", usage, tt.wantTotal)
+			}
+			if elapsed > time.Second {
+				t.Errorf("getStatistics() returned after %v, want it within the stats timeout", elapsed)
+			}
+			if !tt.blocked {
+				return
+			}
+
+			// the statfs still running on the path is not run again
+			calls := 0
+			_, err = getStatistics(path, func(string) ([]*csi.VolumeUsage, error) {
+				calls++
+				return usageOf(20), nil
+			})
+			if err != errStatsTimeout || calls != 0 {
+				t.Errorf("getStatistics() while blocked = %v with %d calls, want the timeout without calls", err, calls)
+			}
+
+			// the statistics of the blocked statfs are cached once it completes
+			close(release)
+			deadline := time.Now().Add(time.Second)
+			for {
+				volumeStats.Lock()
+				done := !volumeStats.entries[path].inProgress
+				volumeStats.Unlock()
+				if done || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			usage, err = getStatistics(path, statistics)
+			if err != nil || len(usage) != 1 || usage[0].Total != 10 {
+				t.Errorf("getStatistics() after the statfs completed = %v, %v, want total 10", usage, err)
+			}
+		})
+	}
+}
+
+func TestForgetStatistics(t *testing.T) {
+	path := "/stats-test/forget"
+	if _, err := getStatistics(path, func(string) ([]*csi.VolumeUsage, error) {
+		return usageOf(10), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	forgetStatistics(path)
+	volumeStats.Lock()
+	_, ok := volumeStats.entries[path]
+	volumeStats.Unlock()
+	if ok {
+		t.Errorf("statistics of %s are not forgotten", path)
+	}
+}
+
+func TestVolumeStatistics(t *testing.T) {
+	ns := &node{mounter: newNodeMounter()}
+	dir := t.TempDir()
+
+	usage, err := ns.volumeStatistics(dir)
+	if err != nil {
+		t.Fatalf("volumeStatistics() error = %v", err)
+	}
+	if len(usage) != 2 || usage[0].Unit != csi.VolumeUsage_BYTES || usage[0].Total <= 0 ||
+		usage[1].Unit != csi.VolumeUsage_INODES {
+		t.Errorf("volumeStatistics() = %v, want the bytes and inodes of the filesystem", usage)
+	}
+
+	_, err = ns.volumeStatistics(filepath.Join(dir, "missing"))
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("volumeStatistics() of a missing path error = %v, want NotFound", err)
+	}
+}
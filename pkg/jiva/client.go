@@ -16,21 +16,75 @@ package jiva
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/openebs/jiva-operator/pkg/volume"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	snapshotDiskPrefix = "volume-snap-"
+	snapshotDiskSuffix = ".img"
+
+	defaultTimeout = 2 * time.Second
+	// resizeSameSizeMsg is returned by the jiva controller
+	// when the volume is already of the requested size
+	resizeSameSizeMsg = "Volume size same as size mentioned"
 )
 
+// HTTPError is the error returned for a response with a non 2xx status
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("Bad response: %d %s: %s", e.StatusCode, e.Status, e.Body)
+}
+
+// ControllerClient is the client of the REST API of the jiva controller,
+// the replicas serve the same API on port 9502
 type ControllerClient struct {
 	Address    string
 	httpClient *http.Client
+	backoff    wait.Backoff
+}
+
+// Option configures the ControllerClient
+type Option func(*ControllerClient)
+
+// WithTimeout sets the timeout of each request, 2s by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *ControllerClient) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithRetries retries the GET requests which fail to reach the controller
+// or get a 5xx response, up to the given number of attempts. The interval
+// between the attempts starts at the given interval and doubles after
+// each attempt.
+func WithRetries(attempts int, interval time.Duration) Option {
+	return func(c *ControllerClient) {
+		c.backoff = wait.Backoff{
+			Steps:    attempts,
+			Duration: interval,
+			Factor:   2.0,
+			Jitter:   0.1,
+		}
+	}
 }
 
-// NewControllerClient create the new controller client
-func NewControllerClient(address string) *ControllerClient {
+// NewControllerClient create the new controller client, the requests are
+// not retried unless the client is created with WithRetries
+func NewControllerClient(address string, opts ...Option) *ControllerClient {
 	if !strings.HasPrefix(address, "http") {
 		address = "http://" + address
 	}
@@ -39,10 +93,15 @@ func NewControllerClient(address string) *ControllerClient {
 		address += "/v1"
 	}
 
-	return &ControllerClient{
+	c := &ControllerClient{
 		Address:    address,
-		httpClient: &http.Client{Timeout: 2 * time.Second},
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		backoff:    wait.Backoff{Steps: 1},
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
 // SetTimeout overrides the default timeout
@@ -50,46 +109,87 @@ func (c *ControllerClient) SetTimeout(interval time.Duration) {
 	c.httpClient.Timeout = interval
 }
 
+// withAddress returns a client of the given address with the
+// timeout and retries of the client
+func (c *ControllerClient) withAddress(address string) *ControllerClient {
+	cli := NewControllerClient(address)
+	cli.httpClient.Timeout = c.httpClient.Timeout
+	cli.backoff = c.backoff
+	return cli
+}
+
 // Get sends a request to the specified path and stores body in the value
 // pointed to by obj.
-func (c *ControllerClient) Get(path string, obj interface{}) error {
-	resp, err := http.Get(c.Address + path)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	return json.NewDecoder(resp.Body).Decode(obj)
+func (c *ControllerClient) Get(ctx context.Context, path string, obj interface{}) error {
+	return c.Do(ctx, http.MethodGet, path, nil, obj)
 }
 
 // Post sends a POST request to the specified path and stores body in the value
 // pointed to by resp.
-func (c *ControllerClient) Post(path string, req, resp interface{}) error {
-	return c.Do("POST", path, req, resp)
+func (c *ControllerClient) Post(ctx context.Context, path string, req, resp interface{}) error {
+	return c.Do(ctx, http.MethodPost, path, req, resp)
 }
 
 // Do sends a request to the specified path and it stores JSON-decoded body
-// from the response into the value pointed to by resp.
-func (c *ControllerClient) Do(method, path string, req, resp interface{}) error {
-	b, err := json.Marshal(req)
-	if err != nil {
-		return err
+// from the response into the value pointed to by resp. A GET request is
+// retried as per the backoff of the client as long as the next attempt
+// starts before the deadline of the context. The other requests are not
+// retried, as the controller may have applied a request which timed out.
+func (c *ControllerClient) Do(ctx context.Context, method, path string, req, resp interface{}) error {
+	return c.send(ctx, method, path, req, resp, method == http.MethodGet)
+}
+
+// send sends the request as Do does, the request is retried as per the
+// backoff of the client only if retry is set, so that the requests which
+// are safe to be applied again can opt in to be retried
+func (c *ControllerClient) send(ctx context.Context, method, path string, req, resp interface{}, retry bool) error {
+	var body []byte
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = b
 	}
 
-	bodyType := "application/json"
 	url := path
 	if !strings.HasPrefix(url, "http") {
 		url = c.Address + path
+	}
 
+	backoff := c.backoff
+	if !retry {
+		backoff.Steps = 1
+	}
+	for {
+		err := c.do(ctx, method, url, body, resp)
+		if err == nil || !isRetryable(err) || ctx.Err() != nil || backoff.Steps <= 1 {
+			return err
+		}
+		wait := backoff.Step()
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%v, last err: %v", ctx.Err(), err)
+		case <-timer.C:
+		}
 	}
+}
 
-	httpReq, err := http.NewRequest(method, url, bytes.NewBuffer(b))
+func (c *ControllerClient) do(ctx context.Context, method, url string, body []byte, resp interface{}) error {
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
-	httpReq.Header.Set("Content-Type", bodyType)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
 
-	httpResp, err := http.DefaultClient.Do(httpReq)
+	httpResp, err := c.httpClient.Do(httpReq)
 	if err != nil {
 		return err
 	}
@@ -97,7 +197,11 @@ func (c *ControllerClient) Do(method, path string, req, resp interface{}) error
 
 	if httpResp.StatusCode >= 300 {
 		content, _ := ioutil.ReadAll(httpResp.Body)
-		return fmt.Errorf("Bad response: %d %s: %s", httpResp.StatusCode, httpResp.Status, content)
+		return &HTTPError{
+			StatusCode: httpResp.StatusCode,
+			Status:     httpResp.Status,
+			Body:       string(content),
+		}
 	}
 
 	if resp == nil {
@@ -105,3 +209,185 @@ func (c *ControllerClient) Do(method, path string, req, resp interface{}) error
 	}
 	return json.NewDecoder(httpResp.Body).Decode(resp)
 }
+
+// isRetryable returns false for the responses which would not change
+// on retrying i.e. the 4xx responses and the resize to the same size
+func isRetryable(err error) bool {
+	if httpErr, ok := err.(*HTTPError); ok {
+		return httpErr.StatusCode >= 500 && !strings.Contains(httpErr.Body, resizeSameSizeMsg)
+	}
+	return true
+}
+
+// GetVolume returns the volume served by the jiva controller
+func (c *ControllerClient) GetVolume(ctx context.Context) (*volume.Volume, error) {
+	vols := volume.Volumes{}
+	if err := c.Get(ctx, "/volumes", &vols); err != nil {
+		return nil, err
+	}
+	if len(vols.Data) == 0 {
+		return nil, fmt.Errorf("no volume found")
+	}
+	return &vols.Data[0], nil
+}
+
+// GetStats returns the stats of the volume and the
+// status of its replicas as seen by the jiva controller
+func (c *ControllerClient) GetStats(ctx context.Context) (*volume.Stats, error) {
+	stats := &volume.Stats{}
+	if err := c.Get(ctx, "/stats", stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ResizeVolume expands the volume to the given size i.e. 10Gi, it
+// succeeds if the volume is already of the given size. The resize is
+// retried like the reads, as a resize which was applied before it
+// timed out succeeds on the retry with the same size.
+func (c *ControllerClient) ResizeVolume(ctx context.Context, size string) error {
+	vol, err := c.GetVolume(ctx)
+	if err != nil {
+		return err
+	}
+	input := volume.ResizeInput{
+		Name: vol.Name,
+		Size: size,
+	}
+	err = c.send(ctx, http.MethodPost, vol.Actions["resize"], input, nil, true)
+	if err != nil && strings.Contains(err.Error(), resizeSameSizeMsg) {
+		return nil
+	}
+	return err
+}
+
+// ListReplicas returns the replicas registered with the jiva controller
+func (c *ControllerClient) ListReplicas(ctx context.Context) ([]volume.ControllerReplica, error) {
+	reps := volume.ControllerReplicas{}
+	if err := c.Get(ctx, "/replicas", &reps); err != nil {
+		return nil, err
+	}
+	return reps.Data, nil
+}
+
+// GetReplica returns the details of the replica, the client must be
+// created with the address of the replica REST API i.e. <ip>:9502
+func (c *ControllerClient) GetReplica(ctx context.Context) (*volume.ReplicaInfo, error) {
+	info := &volume.ReplicaInfo{}
+	if err := c.Get(ctx, "/replicas/1", info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// GetVolUsage returns the usage of the volume as seen by the replica,
+// the client must be created with the address of the replica REST API
+func (c *ControllerClient) GetVolUsage(ctx context.Context) (*volume.VolUsage, error) {
+	usage := &volume.VolUsage{}
+	if err := c.Get(ctx, "/volusage", usage); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// AddReplica registers the replica with the given address i.e.
+// tcp://<ip>:9502 with the jiva controller
+func (c *ControllerClient) AddReplica(ctx context.Context, address string) (*volume.ControllerReplica, error) {
+	rep := &volume.ControllerReplica{}
+	if err := c.Post(ctx, "/replicas", volume.ControllerReplica{Address: address}, rep); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+// DeleteReplica removes the replica with the given address i.e.
+// tcp://<ip>:9502 from the jiva controller
+func (c *ControllerClient) DeleteReplica(ctx context.Context, address string) error {
+	reps, err := c.ListReplicas(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rep := range reps {
+		if rep.Address != address {
+			continue
+		}
+		url := rep.Links["self"]
+		if url == "" {
+			url = "/replicas/" + rep.Id
+		}
+		return c.Do(ctx, http.MethodDelete, url, nil, nil)
+	}
+	return fmt.Errorf("replica %s not found", address)
+}
+
+// CreateSnapshot takes a snapshot of the volume with the given name and
+// returns the name of the snapshot created by the jiva controller
+func (c *ControllerClient) CreateSnapshot(ctx context.Context, name string) (string, error) {
+	vol, err := c.GetVolume(ctx)
+	if err != nil {
+		return "", err
+	}
+	out := volume.SnapshotOutput{}
+	if err := c.Post(ctx, vol.Actions["snapshot"], volume.SnapshotInput{Name: name}, &out); err != nil {
+		return "", err
+	}
+	return out.Id, nil
+}
+
+// DeleteSnapshot deletes the snapshot with the given name from all
+// the replicas of the volume
+func (c *ControllerClient) DeleteSnapshot(ctx context.Context, name string) error {
+	vol, err := c.GetVolume(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Post(ctx, vol.Actions["deleteSnapshot"], volume.SnapshotInput{Name: name}, nil)
+}
+
+// ListSnapshots returns the user created snapshots of the volume keyed by
+// snapshot name. Snapshots are fetched from the first replica in RW mode,
+// since all the healthy replicas share the same chain of snapshots.
+func (c *ControllerClient) ListSnapshots(ctx context.Context) (map[string]volume.DiskInfo, error) {
+	reps, err := c.ListReplicas(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, rep := range reps {
+		if rep.Mode != "RW" {
+			continue
+		}
+		info, err := c.withAddress(ReplicaAddress(rep.Address)).GetReplica(ctx)
+		if err != nil {
+			return nil, err
+		}
+		snapshots := map[string]volume.DiskInfo{}
+		for disk, d := range info.Disks {
+			if d.Removed || !d.UserCreated {
+				continue
+			}
+			name := SnapshotName(disk)
+			if name == "" {
+				continue
+			}
+			snapshots[name] = d
+		}
+		return snapshots, nil
+	}
+	return nil, fmt.Errorf("no replica in RW mode")
+}
+
+// ReplicaAddress converts the address of a replica registered with the
+// jiva controller i.e. tcp://<ip>:9502 into the address of its REST API
+func ReplicaAddress(address string) string {
+	return strings.TrimPrefix(address, "tcp://")
+}
+
+// SnapshotName returns the name of the snapshot from the name of the disk
+// in replica chain i.e. volume-snap-<name>.img, it returns empty string
+// if the disk is not a snapshot
+func SnapshotName(disk string) string {
+	if !strings.HasPrefix(disk, snapshotDiskPrefix) || !strings.HasSuffix(disk, snapshotDiskSuffix) {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(disk, snapshotDiskPrefix), snapshotDiskSuffix)
+}
@@ -0,0 +1,201 @@
+// Copyright © 2021 The OpenEBS Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jiva
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openebs/jiva-operator/pkg/volume"
+)
+
+// failingServer fails the first failures requests with the given status
+// and then serves the stats, the number of requests is counted in calls
+func failingServer(failures int32, status int, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(volume.Stats{TargetStatus: "RW"})
+	}))
+}
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		failures  int32
+		status    int
+		attempts  int
+		wantErr   bool
+		wantCalls int32
+	}{
+		{name: "No retries by default", failures: 1, status: http.StatusServiceUnavailable, wantErr: true, wantCalls: 1},
+		{name: "Retried on 5xx", failures: 2, status: http.StatusServiceUnavailable, attempts: 3, wantCalls: 3},
+		{name: "Attempts exhausted", failures: 5, status: http.StatusInternalServerError, attempts: 3, wantErr: true, wantCalls: 3},
+		{name: "Not retried on 4xx", failures: 1, status: http.StatusBadRequest, attempts: 3, wantErr: true, wantCalls: 1},
+		{name: "Post not retried", method: http.MethodPost, failures: 1, status: http.StatusServiceUnavailable, attempts: 3, wantErr: true, wantCalls: 1},
+		{name: "Delete not retried", method: http.MethodDelete, failures: 1, status: http.StatusServiceUnavailable, attempts: 3, wantErr: true, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			srv := failingServer(tt.failures, tt.status, &calls)
+			defer srv.Close()
+
+			opts := []Option{}
+			if tt.attempts > 0 {
+				opts = append(opts, WithRetries(tt.attempts, time.Millisecond))
+			}
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			stats := volume.Stats{}
+			err := NewControllerClient(srv.URL, opts...).Do(context.TODO(), method, "/stats", nil, &stats)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && stats.TargetStatus != "RW" {
+				t.Errorf("Do() status = %s, want RW", stats.TargetStatus)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("requests = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr {
+				if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != tt.status {
+					t.Errorf("Do() error = %#v, want HTTPError with status %d", err, tt.status)
+				}
+			}
+		})
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var calls int32
+	srv := failingServer(100, http.StatusServiceUnavailable, &calls)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	cli := NewControllerClient(srv.URL, WithRetries(100, 20*time.Millisecond))
+	start := time.Now()
+	if _, err := cli.GetStats(ctx); err == nil {
+		t.Fatal("GetStats() should fail once the context is done")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetStats() returned after %s, want it to stop with the context", elapsed)
+	}
+}
+
+func TestDoDeadline(t *testing.T) {
+	var calls int32
+	srv := failingServer(100, http.StatusServiceUnavailable, &calls)
+	defer srv.Close()
+
+	// the retry would start after the deadline of the context
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	cli := NewControllerClient(srv.URL, WithRetries(5, 2*time.Second))
+	start := time.Now()
+	_, err := cli.GetStats(ctx)
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("GetStats() error = %#v, want the error of the last attempt", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("GetStats() returned after %s, want it to return without waiting", elapsed)
+	}
+	if calls != 1 {
+		t.Errorf("requests = %d, want 1", calls)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	_, err := NewControllerClient(srv.URL, WithTimeout(20*time.Millisecond)).GetStats(context.TODO())
+	if err == nil {
+		t.Fatal("GetStats() should time out")
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("GetStats() returned after %s, want the client timeout", elapsed)
+	}
+}
+
+func TestResizeVolume(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int32
+		resizeResp string
+		status     int
+		wantErr    bool
+		wantCalls  int32
+	}{
+		{name: "Resized", status: http.StatusOK, wantCalls: 1},
+		{name: "Same size", status: http.StatusInternalServerError, resizeResp: resizeSameSizeMsg, wantCalls: 1},
+		{name: "Failed", status: http.StatusInternalServerError, resizeResp: "failed to resize", wantErr: true, wantCalls: 2},
+		{name: "Retried", failures: 1, status: http.StatusOK, wantCalls: 2},
+		{name: "Applied before failing", failures: 1, status: http.StatusInternalServerError,
+			resizeResp: resizeSameSizeMsg, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv *httptest.Server
+			var gotInput volume.ResizeInput
+			var calls int32
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/volumes":
+					vol := volume.Volume{Name: "pvc-1"}
+					vol.Actions = map[string]string{"resize": srv.URL + "/v1/volumes/pvc-1?action=resize"}
+					_ = json.NewEncoder(w).Encode(volume.Volumes{Data: []volume.Volume{vol}})
+				case "/v1/volumes/pvc-1":
+					_ = json.NewDecoder(r.Body).Decode(&gotInput)
+					if atomic.AddInt32(&calls, 1) <= tt.failures {
+						http.Error(w, "unavailable", http.StatusServiceUnavailable)
+						return
+					}
+					if tt.status != http.StatusOK {
+						http.Error(w, tt.resizeResp, tt.status)
+					}
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+
+			err := NewControllerClient(srv.URL, WithRetries(2, time.Millisecond)).ResizeVolume(context.TODO(), "10Gi")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResizeVolume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotInput.Name != "pvc-1" || gotInput.Size != "10Gi" {
+				t.Errorf("resize input = %+v", gotInput)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("resize requests = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
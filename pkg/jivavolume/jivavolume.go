@@ -139,3 +139,9 @@ func (j *Jiva) WithCapacity(capacity string) *Jiva {
 	j.jvObj.Spec.Capacity = capacity
 	return j
 }
+
+// WithVolumeSource defines the VolumeSource field of JivaVolumeSpec
+func (j *Jiva) WithVolumeSource(src *jv.VolumeSource) *Jiva {
+	j.jvObj.Spec.VolumeSource = src
+	return j
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"reflect"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/openebs/jiva-operator/pkg/apis"
@@ -32,8 +33,12 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	"k8s.io/cloud-provider/volume/helpers"
@@ -77,6 +82,11 @@ func New(config *rest.Config) (*Client, error) {
 	return c, nil
 }
 
+// NewForClient wraps the given client, i.e. the fake client in the tests
+func NewForClient(c client.Client) *Client {
+	return &Client{client: c}
+}
+
 // Set sets the client using the config
 func (cl *Client) Set() error {
 	c, err := client.New(cl.cfg, client.Options{})
@@ -150,8 +160,9 @@ func getdefaultAnnotations(policy string) map[string]string {
 }
 
 // CreateJivaVolume check whether JivaVolume CR already exists and creates one
-// if it doesn't exist.
-func (cl *Client) CreateJivaVolume(req *csi.CreateVolumeRequest) (string, error) {
+// if it doesn't exist. The src, if set, is the snapshot the data of
+// the volume is cloned from.
+func (cl *Client) CreateJivaVolume(req *csi.CreateVolumeRequest, src *jv.VolumeSource) (string, error) {
 	var (
 		sizeBytes  int64
 		accessType string
@@ -191,6 +202,7 @@ func (cl *Client) CreateJivaVolume(req *csi.CreateVolumeRequest) (string, error)
 		WithPV(name).
 		WithCapacity(capacity).
 		WithAccessType(accessType).
+		WithVolumeSource(src).
 		WithVersionDetails()
 
 	if jiva.Errs != nil {
@@ -216,6 +228,10 @@ func (cl *Client) CreateJivaVolume(req *csi.CreateVolumeRequest) (string, error)
 		return "", status.Errorf(codes.AlreadyExists, "Failed to create JivaVolume CR, volume with different size already exists")
 	}
 
+	if !reflect.DeepEqual(objExists.Spec.VolumeSource, obj.Spec.VolumeSource) {
+		return "", status.Errorf(codes.AlreadyExists, "Failed to create JivaVolume CR, volume with different source already exists")
+	}
+
 	return name, nil
 }
 
@@ -291,6 +307,100 @@ func (cl *Client) GetNode(nodeName string) (*corev1.Node, error) {
 
 }
 
+// GetJivaVolumePolicy returns the JivaVolumePolicy with the given name
+func (cl *Client) GetJivaVolumePolicy(name string) (*jv.JivaVolumePolicy, error) {
+	policy := &jv.JivaVolumePolicy{}
+	if err := cl.client.Get(context.TODO(),
+		types.NamespacedName{Name: name, Namespace: GetOpenEBSNamespace()}, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// ListNodes returns the list of nodes having all the given labels
+func (cl *Client) ListNodes(labels map[string]string) (*corev1.NodeList, error) {
+	nodes := &corev1.NodeList{}
+	if err := cl.client.List(context.TODO(), nodes, client.MatchingLabels(labels)); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// AnnotateNode sets the given annotations on the node
+func (cl *Client) AnnotateNode(nodeName string, annotations map[string]string) error {
+	node := &corev1.Node{}
+	if err := cl.client.Get(context.TODO(), types.NamespacedName{Name: nodeName}, node); err != nil {
+		return err
+	}
+	newNode := node.DeepCopy()
+	if newNode.Annotations == nil {
+		newNode.Annotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		newNode.Annotations[k] = v
+	}
+	return cl.client.Patch(context.TODO(), newNode, client.MergeFrom(node))
+}
+
+// GetStorageClass returns the storage class with the given name
+func (cl *Client) GetStorageClass(name string) (*storagev1.StorageClass, error) {
+	sc := &storagev1.StorageClass{}
+	if err := cl.client.Get(context.TODO(), types.NamespacedName{Name: name}, sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// ListPVCsWithStorageClass returns the PVCs across all the namespaces
+// which are provisioned using the given storage class
+func (cl *Client) ListPVCsWithStorageClass(storageClass string) ([]corev1.PersistentVolumeClaim, error) {
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := cl.client.List(context.TODO(), pvcs); err != nil {
+		return nil, err
+	}
+
+	var items []corev1.PersistentVolumeClaim
+	for _, pvc := range pvcs.Items {
+		if pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName == storageClass {
+			items = append(items, pvc)
+		}
+	}
+	return items, nil
+}
+
+// ListCSIStorageCapacities returns the CSIStorageCapacity objects published
+// for the given storage class. The objects are fetched as unstructured in
+// the preferred version of the API served by the cluster, no objects are
+// returned if the API is not served at all.
+func (cl *Client) ListCSIStorageCapacities(storageClass string) ([]unstructured.Unstructured, error) {
+	mapping, err := cl.client.RESTMapper().RESTMapping(
+		schema.GroupKind{Group: "storage.k8s.io", Kind: "CSIStorageCapacity"})
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(mapping.GroupVersionKind.GroupVersion().WithKind("CSIStorageCapacityList"))
+	if err := cl.client.List(context.TODO(), list); err != nil {
+		if meta.IsNoMatchError(err) || k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var items []unstructured.Unstructured
+	for _, item := range list.Items {
+		sc, _, _ := unstructured.NestedString(item.Object, "storageClassName")
+		if sc == storageClass {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
 // GetOpenEBSNamespace returns namespace where
 // jiva operator is running
 func GetOpenEBSNamespace() string {
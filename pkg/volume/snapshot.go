@@ -0,0 +1,82 @@
+// Copyright © 2021 The OpenEBS Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package volume
+
+// SnapshotInput is the input for creating or deleting a snapshot
+type SnapshotInput struct {
+	Resource
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// SnapshotOutput is the response of the snapshot request, the Id of
+// the resource is the name of the snapshot
+type SnapshotOutput struct {
+	Resource
+}
+
+// ControllerReplica keeps the address and mode of a replica
+// as registered with the jiva controller
+type ControllerReplica struct {
+	Resource
+	Address string `json:"address"`
+	Mode    string `json:"mode"`
+}
+
+// ControllerReplicas is the list of replicas registered with
+// the jiva controller
+type ControllerReplicas struct {
+	Collection
+	Data []ControllerReplica `json:"data"`
+}
+
+// ReplicaInfo keeps the details of a replica fetched from the
+// replica REST API
+type ReplicaInfo struct {
+	Resource
+	Dirty           bool                `json:"dirty"`
+	Rebuilding      bool                `json:"rebuilding"`
+	Head            string              `json:"head"`
+	Parent          string              `json:"parent"`
+	Size            string              `json:"size"`
+	SectorSize      int64               `json:"sectorSize"`
+	State           string              `json:"state"`
+	Chain           []string            `json:"chain"`
+	Disks           map[string]DiskInfo `json:"disks"`
+	RevisionCounter string              `json:"revisioncounter"`
+}
+
+// VolUsage keeps the usage of the volume as seen by a
+// replica, fetched from the replica REST API
+type VolUsage struct {
+	Resource
+	RevisionCounter   string `json:"revisioncounter"`
+	UsedLogicalBlocks string `json:"usedlogicalblocks"`
+	UsedBlocks        string `json:"usedblocks"`
+	SectorSize        string `json:"sectorSize"`
+}
+
+// DiskInfo keeps the info about a disk in the replica chain,
+// a disk is either the volume head or a snapshot
+type DiskInfo struct {
+	Name        string            `json:"name"`
+	Parent      string            `json:"parent"`
+	Children    []string          `json:"children"`
+	Removed     bool              `json:"removed"`
+	UserCreated bool              `json:"usercreated"`
+	Created     string            `json:"created"`
+	Size        string            `json:"size"`
+	Labels      map[string]string `json:"labels"`
+}
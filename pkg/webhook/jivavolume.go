@@ -0,0 +1,220 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/openebs/jiva-operator/version"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+const (
+	// JivaVolumeValidatePath is the path the JivaVolume
+	// validating webhook is served at
+	JivaVolumeValidatePath = "/validate-openebs-io-v1alpha1-jivavolume"
+	// JivaVolumeMutatePath is the path the JivaVolume
+	// mutating webhook is served at
+	JivaVolumeMutatePath = "/mutate-openebs-io-v1alpha1-jivavolume"
+
+	// minScaledownReplicationFactor is the lowest replication factor a
+	// volume can be scaled down to, as the reconciler only removes a
+	// replica while the remaining ones form the qurom
+	minScaledownReplicationFactor = 2
+)
+
+// JivaVolumeValidator rejects the changes to a JivaVolume
+// which would corrupt the volume
+type JivaVolumeValidator struct {
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &JivaVolumeValidator{}
+var _ admission.DecoderInjector = &JivaVolumeValidator{}
+
+// InjectDecoder implements admission.DecoderInjector
+func (v *JivaVolumeValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler
+func (v *JivaVolumeValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	jv := &openebsiov1alpha1.JivaVolume{}
+	if err := v.decoder.Decode(req, jv); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var err error
+	switch req.Operation {
+	case admissionv1.Create:
+		err = ValidateJivaVolume(jv)
+	case admissionv1.Update:
+		old := &openebsiov1alpha1.JivaVolume{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		err = ValidateJivaVolumeUpdate(old, jv)
+	}
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+// ValidateJivaVolume checks the fields of a new JivaVolume
+func ValidateJivaVolume(jv *openebsiov1alpha1.JivaVolume) error {
+	specPath := field.NewPath("spec")
+	allErrs := field.ErrorList{}
+	if jv.Spec.PV == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("pv"), ""))
+	}
+	if _, err := resource.ParseQuantity(jv.Spec.Capacity); err != nil {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("capacity"), jv.Spec.Capacity, err.Error()))
+	}
+	if jv.Spec.DesiredReplicationFactor < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("desiredReplicationFactor"),
+			jv.Spec.DesiredReplicationFactor, "must not be negative"))
+	}
+	return allErrs.ToAggregate()
+}
+
+// ValidateJivaVolumeUpdate checks that the identity of the volume is not
+// changed, that the capacity only grows and that the replication factor
+// is changed the way the reconciler supports
+func ValidateJivaVolumeUpdate(old, jv *openebsiov1alpha1.JivaVolume) error {
+	specPath := field.NewPath("spec")
+	allErrs := field.ErrorList{}
+
+	if jv.Spec.PV != old.Spec.PV {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("pv"), "field is immutable"))
+	}
+	if jv.Spec.AccessType != old.Spec.AccessType {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("accessType"), "field is immutable"))
+	}
+	if !equality.Semantic.DeepEqual(jv.Spec.VolumeSource, old.Spec.VolumeSource) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("volumeSource"), "field is immutable"))
+	}
+	// the iscsi details are filled in by the operator
+	// once the target service is created
+	iscsiPath := specPath.Child("iscsiSpec")
+	if old.Spec.ISCSISpec.TargetIP != "" && jv.Spec.ISCSISpec.TargetIP != old.Spec.ISCSISpec.TargetIP {
+		allErrs = append(allErrs, field.Forbidden(iscsiPath.Child("targetIP"), "field is immutable once set"))
+	}
+	if old.Spec.ISCSISpec.TargetPort != 0 && jv.Spec.ISCSISpec.TargetPort != old.Spec.ISCSISpec.TargetPort {
+		allErrs = append(allErrs, field.Forbidden(iscsiPath.Child("targetPort"), "field is immutable once set"))
+	}
+	if old.Spec.ISCSISpec.Iqn != "" && jv.Spec.ISCSISpec.Iqn != old.Spec.ISCSISpec.Iqn {
+		allErrs = append(allErrs, field.Forbidden(iscsiPath.Child("iqn"), "field is immutable once set"))
+	}
+
+	capacityPath := specPath.Child("capacity")
+	capacity, err := resource.ParseQuantity(jv.Spec.Capacity)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(capacityPath, jv.Spec.Capacity, err.Error()))
+	} else if oldCapacity, err := resource.ParseQuantity(old.Spec.Capacity); err == nil &&
+		capacity.Cmp(oldCapacity) < 0 {
+		allErrs = append(allErrs, field.Invalid(capacityPath, jv.Spec.Capacity,
+			"must not be less than the current capacity "+old.Spec.Capacity))
+	}
+
+	if jv.Spec.DesiredReplicationFactor != old.Spec.DesiredReplicationFactor {
+		allErrs = append(allErrs, validateReplicationFactorChange(old, jv,
+			specPath.Child("desiredReplicationFactor"))...)
+	}
+	return allErrs.ToAggregate()
+}
+
+// validateReplicationFactorChange checks the change in the desired
+// replication factor against the scaleup and scaledown of the reconciler
+func validateReplicationFactorChange(old, jv *openebsiov1alpha1.JivaVolume, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	desired := jv.Spec.DesiredReplicationFactor
+	rf := jv.Spec.Policy.Target.ReplicationFactor
+	switch {
+	case desired < 0:
+		allErrs = append(allErrs, field.Invalid(fldPath, desired, "must not be negative"))
+	case rf == 0 || old.Spec.DesiredReplicationFactor == 0:
+		// the replication factor is populated from the policy
+		// by the operator while bootstrapping the volume
+	case jv.Status.Scaleup != nil:
+		allErrs = append(allErrs, field.Forbidden(fldPath,
+			"replicas are being scaled up, the change is allowed once the scaleup completes"))
+	case desired < rf && desired < minScaledownReplicationFactor:
+		allErrs = append(allErrs, field.Invalid(fldPath, desired,
+			"the replicas can't be scaled down below 2 without losing the qurom"))
+	}
+	return allErrs
+}
+
+// JivaVolumeDefaulter sets the version details of a new JivaVolume
+// to the version of the operator when they are not provided
+type JivaVolumeDefaulter struct {
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &JivaVolumeDefaulter{}
+var _ admission.DecoderInjector = &JivaVolumeDefaulter{}
+
+// InjectDecoder implements admission.DecoderInjector
+func (d *JivaVolumeDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// Handle implements admission.Handler
+func (d *JivaVolumeDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create {
+		return admission.Allowed("")
+	}
+	jv := &openebsiov1alpha1.JivaVolume{}
+	if err := d.decoder.Decode(req, jv); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !DefaultVersionDetails(jv) {
+		return admission.Allowed("")
+	}
+	marshaled, err := json.Marshal(jv)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// DefaultVersionDetails sets the current and desired versions of the
+// volume to the version of the operator if they are empty, true is
+// returned if the version details are changed
+func DefaultVersionDetails(jv *openebsiov1alpha1.JivaVolume) bool {
+	changed := false
+	if jv.VersionDetails.Status.Current == "" {
+		jv.VersionDetails.Status.Current = version.Version
+		jv.VersionDetails.Status.DependentsUpgraded = true
+		changed = true
+	}
+	if jv.VersionDetails.Desired == "" {
+		jv.VersionDetails.Desired = jv.VersionDetails.Status.Current
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"testing"
+
+	"github.com/openebs/jiva-operator/version"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+func liveVolume() *openebsiov1alpha1.JivaVolume {
+	jv := &openebsiov1alpha1.JivaVolume{}
+	jv.Spec.PV = "pvc-1"
+	jv.Spec.AccessType = "mount"
+	jv.Spec.Capacity = "5Gi"
+	jv.Spec.ISCSISpec = openebsiov1alpha1.ISCSISpec{
+		TargetIP:   "10.0.0.1",
+		TargetPort: 3260,
+		Iqn:        "iqn.2016-09.com.openebs.jiva:pvc-1",
+	}
+	jv.Spec.Policy.Target.ReplicationFactor = 3
+	jv.Spec.DesiredReplicationFactor = 3
+	return jv
+}
+
+func TestValidateJivaVolumeUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     func(jv *openebsiov1alpha1.JivaVolume)
+		update  func(jv *openebsiov1alpha1.JivaVolume)
+		wantErr bool
+	}{
+		{
+			name:   "no change",
+			update: func(jv *openebsiov1alpha1.JivaVolume) {},
+		},
+		{
+			name:    "pv changed",
+			update:  func(jv *openebsiov1alpha1.JivaVolume) { jv.Spec.PV = "pvc-2" },
+			wantErr: true,
+		},
+		{
+			name:    "access type changed",
+			update:  func(jv *openebsiov1alpha1.JivaVolume) { jv.Spec.AccessType = "block" },
+			wantErr: true,
+		},
+		{
+			name:    "target ip changed",
+			update:  func(jv *openebsiov1alpha1.JivaVolume) { jv.Spec.ISCSISpec.TargetIP = "10.0.0.2" },
+			wantErr: true,
+		},
+		{
+			name:   "iscsi details filled in",
+			old:    func(jv *openebsiov1alpha1.JivaVolume) { jv.Spec.ISCSISpec = openebsiov1alpha1.ISCSISpec{} },
+			update: func(jv *openebsiov1alpha1.JivaVolume) {},
+		},
+		{
+			name:   "capacity expanded",
+			update: func(jv *openebsiov1alpha1.JivaVolume) { jv.Spec.Capacity = "10Gi" },
+		},
+		{
+			name:    "capacity shrunk",
+			update:  func(jv *openebsiov1alpha1.JivaVolume) { jv.Spec.Capacity = "4Gi" },
+			wantErr: true,
+		},
+		{
+			name:   "scaled up",
+			update: func(jv *openebsiov1alpha1.JivaVolume) { jv.Spec.DesiredReplicationFactor = 5 },
+		},
+		{
+			name:   "scaled down to 2",
+			update: func(jv *openebsiov1alpha1.JivaVolume) { jv.Spec.DesiredReplicationFactor = 2 },
+		},
+		{
+			name:    "scaled down to 1",
+			update:  func(jv *openebsiov1alpha1.JivaVolume) { jv.Spec.DesiredReplicationFactor = 1 },
+			wantErr: true,
+		},
+		{
+			name: "scaled while scaling up",
+			update: func(jv *openebsiov1alpha1.JivaVolume) {
+				jv.Spec.DesiredReplicationFactor = 4
+				jv.Status.Scaleup = &openebsiov1alpha1.ScaleupStatus{}
+			},
+			wantErr: true,
+		},
+		{
+			name: "populated while bootstrapping",
+			old: func(jv *openebsiov1alpha1.JivaVolume) {
+				jv.Spec.Policy.Target.ReplicationFactor = 0
+				jv.Spec.DesiredReplicationFactor = 0
+			},
+			update: func(jv *openebsiov1alpha1.JivaVolume) {
+				jv.Spec.Policy.Target.ReplicationFactor = 1
+				jv.Spec.DesiredReplicationFactor = 1
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := liveVolume()
+			if tt.old != nil {
+				tt.old(old)
+			}
+			jv := liveVolume()
+			tt.update(jv)
+			err := ValidateJivaVolumeUpdate(old, jv)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJivaVolumeUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultVersionDetails(t *testing.T) {
+	jv := &openebsiov1alpha1.JivaVolume{}
+	if !DefaultVersionDetails(jv) {
+		t.Fatalf("version details not defaulted")
+	}
+	if jv.VersionDetails.Status.Current != version.Version || jv.VersionDetails.Desired != version.Version {
+		t.Errorf("version details = %+v, want %s", jv.VersionDetails, version.Version)
+	}
+
+	jv = &openebsiov1alpha1.JivaVolume{}
+	jv.VersionDetails.Status.Current = "2.6.0"
+	DefaultVersionDetails(jv)
+	if jv.VersionDetails.Desired != "2.6.0" {
+		t.Errorf("desired version = %s, want the current version", jv.VersionDetails.Desired)
+	}
+	if DefaultVersionDetails(jv) {
+		t.Errorf("version details defaulted again")
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+const (
+	// JivaVolumePolicyPath is the path the JivaVolumePolicy
+	// validating webhook is served at
+	JivaVolumePolicyPath = "/validate-openebs-io-v1alpha1-jivavolumepolicy"
+
+	replicaAntiAffinityKey = openebsiov1alpha1.ReplicaAntiAffinityKey
+)
+
+// JivaVolumePolicyValidator rejects the JivaVolumePolicies
+// which would fail the provisioning of the volumes
+type JivaVolumePolicyValidator struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &JivaVolumePolicyValidator{}
+var _ admission.DecoderInjector = &JivaVolumePolicyValidator{}
+
+// InjectDecoder implements admission.DecoderInjector
+func (v *JivaVolumePolicyValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler
+func (v *JivaVolumePolicyValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	policy := &openebsiov1alpha1.JivaVolumePolicy{}
+	if err := v.decoder.Decode(req, policy); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := ValidateJivaVolumePolicy(ctx, v.Client, policy); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+// ValidateJivaVolumePolicy checks the replication factor, the replica
+// storage class and the affinities of the replicas in the policy. A nil
+// error is returned if the policy is valid, the fields left empty are
+// defaulted by the operator.
+func ValidateJivaVolumePolicy(ctx context.Context, c client.Client,
+	policy *openebsiov1alpha1.JivaVolumePolicy) error {
+	specPath := field.NewPath("spec")
+	allErrs := validateReplicationFactor(policy.Spec.Target.ReplicationFactor,
+		specPath.Child("target", "replicationFactor"))
+
+	if policy.Spec.ReplicaSC != "" {
+		scPath := specPath.Child("replicaSC")
+		sc := &storagev1.StorageClass{}
+		err := c.Get(ctx, types.NamespacedName{Name: policy.Spec.ReplicaSC}, sc)
+		if errors.IsNotFound(err) {
+			allErrs = append(allErrs, field.NotFound(scPath, policy.Spec.ReplicaSC))
+		} else if err != nil {
+			allErrs = append(allErrs, field.InternalError(scPath, err))
+		}
+	}
+
+	allErrs = append(allErrs, validateReplicaAffinity(policy.Spec.Replica.Affinity,
+		specPath.Child("replica", "affinity"))...)
+
+	if poll := policy.Spec.StatusPoll; poll != nil {
+		pollPath := specPath.Child("statusPoll")
+		if poll.SyncingInterval != nil && poll.SyncingInterval.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(pollPath.Child("syncingInterval"),
+				poll.SyncingInterval.Duration.String(), "must be greater than zero"))
+		}
+		if poll.ReadyInterval != nil && poll.ReadyInterval.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(pollPath.Child("readyInterval"),
+				poll.ReadyInterval.Duration.String(), "must be greater than zero"))
+		}
+	}
+	return allErrs.ToAggregate()
+}
+
+// validateReplicationFactor checks that a quorum of replicas can be
+// formed, so an odd number of replicas is needed. Zero is defaulted.
+func validateReplicationFactor(rf int, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if rf < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, rf, "must not be negative"))
+	} else if rf%2 == 0 && rf != 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, rf,
+			"must be an odd number for the replicas to form a quorum"))
+	}
+	return allErrs
+}
+
+// validateReplicaAffinity checks that the replica anti-affinity can be
+// set as the label of the replicas and that the pod affinity and the pod
+// anti-affinity don't require the same pods on and off the same topology
+func validateReplicaAffinity(affinity *corev1.Affinity, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if affinity == nil || affinity.PodAntiAffinity == nil {
+		return allErrs
+	}
+
+	antiAffinityPath := fldPath.Child("podAntiAffinity", "requiredDuringSchedulingIgnoredDuringExecution")
+	antiAffinityTerms := affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	antiAffinityValue := ""
+	for i, term := range antiAffinityTerms {
+		termPath := antiAffinityPath.Index(i).Child("labelSelector")
+		value, ok, err := openebsiov1alpha1.ReplicaAntiAffinityValue(term.LabelSelector)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(termPath, term.LabelSelector, err.Error()))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if antiAffinityValue != "" && value != antiAffinityValue {
+			allErrs = append(allErrs, field.Invalid(termPath, value,
+				fmt.Sprintf("conflicts with %s=%s of another term", replicaAntiAffinityKey, antiAffinityValue)))
+			continue
+		}
+		antiAffinityValue = value
+	}
+
+	if affinity.PodAffinity == nil {
+		return allErrs
+	}
+	for i, antiTerm := range antiAffinityTerms {
+		for _, term := range affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			if term.TopologyKey == antiTerm.TopologyKey &&
+				equality.Semantic.DeepEqual(term.LabelSelector, antiTerm.LabelSelector) &&
+				equality.Semantic.DeepEqual(term.Namespaces, antiTerm.Namespaces) {
+				allErrs = append(allErrs, field.Invalid(antiAffinityPath.Index(i), antiTerm.TopologyKey,
+					"conflicts with a pod affinity term of the same label selector and topology"))
+			}
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openebsiov1alpha1 "github.com/openebs/jiva-operator/pkg/apis/openebs/v1alpha1"
+)
+
+func antiAffinityTerm(value, topology string) corev1.PodAffinityTerm {
+	return corev1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{replicaAntiAffinityKey: value},
+		},
+		TopologyKey: topology,
+	}
+}
+
+func antiAffinityExprTerm(key string, op metav1.LabelSelectorOperator, values ...string) corev1.PodAffinityTerm {
+	return corev1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: key, Operator: op, Values: values},
+			},
+		},
+		TopologyKey: "kubernetes.io/hostname",
+	}
+}
+
+func TestValidateJivaVolumePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    openebsiov1alpha1.JivaVolumePolicySpec
+		wantErr bool
+	}{
+		{
+			name: "default policy",
+		},
+		{
+			name: "valid policy",
+			spec: openebsiov1alpha1.JivaVolumePolicySpec{
+				ReplicaSC: "openebs-hostpath",
+				Target:    openebsiov1alpha1.TargetSpec{ReplicationFactor: 3},
+			},
+		},
+		{
+			name: "even replication factor",
+			spec: openebsiov1alpha1.JivaVolumePolicySpec{
+				Target: openebsiov1alpha1.TargetSpec{ReplicationFactor: 2},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative replication factor",
+			spec: openebsiov1alpha1.JivaVolumePolicySpec{
+				Target: openebsiov1alpha1.TargetSpec{ReplicationFactor: -1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing storage class",
+			spec: openebsiov1alpha1.JivaVolumePolicySpec{
+				ReplicaSC: "openebs-hostpth",
+			},
+			wantErr: true,
+		},
+		{
+			name: "conflicting anti-affinity values",
+			spec: openebsiov1alpha1.JivaVolumePolicySpec{
+				Replica: openebsiov1alpha1.ReplicaSpec{
+					PodTemplateResources: openebsiov1alpha1.PodTemplateResources{
+						Affinity: &corev1.Affinity{
+							PodAntiAffinity: &corev1.PodAntiAffinity{
+								RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+									antiAffinityTerm("app-a", "kubernetes.io/hostname"),
+									antiAffinityTerm("app-b", "kubernetes.io/hostname"),
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "anti-affinity with other selectors",
+			spec: openebsiov1alpha1.JivaVolumePolicySpec{
+				Replica: openebsiov1alpha1.ReplicaSpec{
+					PodTemplateResources: openebsiov1alpha1.PodTemplateResources{
+						Affinity: &corev1.Affinity{
+							PodAntiAffinity: &corev1.PodAntiAffinity{
+								RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+									antiAffinityTerm("app-a", "kubernetes.io/hostname"),
+									antiAffinityExprTerm("app", metav1.LabelSelectorOpNotIn, "db", "cache"),
+									antiAffinityExprTerm("tier", metav1.LabelSelectorOpExists),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "anti-affinity with a single value expression",
+			spec: openebsiov1alpha1.JivaVolumePolicySpec{
+				Replica: openebsiov1alpha1.ReplicaSpec{
+					PodTemplateResources: openebsiov1alpha1.PodTemplateResources{
+						Affinity: &corev1.Affinity{
+							PodAntiAffinity: &corev1.PodAntiAffinity{
+								RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+									antiAffinityExprTerm(replicaAntiAffinityKey, metav1.LabelSelectorOpIn, "app-a"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "anti-affinity with many values",
+			spec: openebsiov1alpha1.JivaVolumePolicySpec{
+				Replica: openebsiov1alpha1.ReplicaSpec{
+					PodTemplateResources: openebsiov1alpha1.PodTemplateResources{
+						Affinity: &corev1.Affinity{
+							PodAntiAffinity: &corev1.PodAntiAffinity{
+								RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+									antiAffinityExprTerm(replicaAntiAffinityKey, metav1.LabelSelectorOpIn, "app-a", "app-b"),
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "affinity and anti-affinity to the same pods",
+			spec: openebsiov1alpha1.JivaVolumePolicySpec{
+				Replica: openebsiov1alpha1.ReplicaSpec{
+					PodTemplateResources: openebsiov1alpha1.PodTemplateResources{
+						Affinity: &corev1.Affinity{
+							PodAffinity: &corev1.PodAffinity{
+								RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+									antiAffinityTerm("app-a", "kubernetes.io/hostname"),
+								},
+							},
+							PodAntiAffinity: &corev1.PodAntiAffinity{
+								RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+									antiAffinityTerm("app-a", "kubernetes.io/hostname"),
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "non positive poll interval",
+			spec: openebsiov1alpha1.JivaVolumePolicySpec{
+				StatusPoll: &openebsiov1alpha1.StatusPollSpec{
+					ReadyInterval: &metav1.Duration{Duration: -time.Second},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "openebs-hostpath"},
+			Provisioner: "openebs.io/local",
+		},
+	).Build()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &openebsiov1alpha1.JivaVolumePolicy{Spec: tt.spec}
+			err := ValidateJivaVolumePolicy(context.TODO(), c, policy)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJivaVolumePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The OpenEBS Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SemVer is a semantic version as per https://semver.org,
+// the build metadata is dropped as it has no precedence
+type SemVer struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	PreRelease []string
+}
+
+// ParseSemVer parses a version of the form MAJOR.MINOR.PATCH[-PRERELEASE]
+// with an optional leading v. The patch version can be left out, as in
+// 2.10, and is taken as 0.
+func ParseSemVer(v string) (SemVer, error) {
+	sv := SemVer{}
+	s := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		preRelease := s[i+1:]
+		s = s[:i]
+		if preRelease == "" {
+			return sv, fmt.Errorf("invalid version %q: empty pre-release", v)
+		}
+		for _, id := range strings.Split(preRelease, ".") {
+			if id == "" {
+				return sv, fmt.Errorf("invalid version %q: empty pre-release identifier", v)
+			}
+			if isNumeric(id) && len(id) > 1 && id[0] == '0' {
+				return sv, fmt.Errorf("invalid version %q: leading zero in pre-release identifier %s", v, id)
+			}
+			sv.PreRelease = append(sv.PreRelease, id)
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return sv, fmt.Errorf("invalid version %q: expected MAJOR.MINOR.PATCH", v)
+	}
+	nums := make([]uint64, 3)
+	for i, part := range parts {
+		if !isNumeric(part) {
+			return sv, fmt.Errorf("invalid version %q: %q is not a number", v, part)
+		}
+		if len(part) > 1 && part[0] == '0' {
+			return sv, fmt.Errorf("invalid version %q: leading zero in %s", v, part)
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return sv, fmt.Errorf("invalid version %q: %v", v, err)
+		}
+		nums[i] = n
+	}
+	sv.Major, sv.Minor, sv.Patch = nums[0], nums[1], nums[2]
+	return sv, nil
+}
+
+// String returns the version in the MAJOR.MINOR.PATCH[-PRERELEASE] form
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.PreRelease) > 0 {
+		s += "-" + strings.Join(v.PreRelease, ".")
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if the version is lower than, equal to or
+// higher than the other version. A pre-release is lower than the release,
+// so 2.11.0-RC1 < 2.11.0-RC2 < 2.11.0.
+func (v SemVer) Compare(o SemVer) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	switch {
+	case len(v.PreRelease) == 0 && len(o.PreRelease) == 0:
+		return 0
+	case len(v.PreRelease) == 0:
+		return 1
+	case len(o.PreRelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.PreRelease) && i < len(o.PreRelease); i++ {
+		if c := comparePreRelease(v.PreRelease[i], o.PreRelease[i]); c != 0 {
+			return c
+		}
+	}
+	// the longer set of pre-release identifiers is higher
+	// if all the preceding identifiers are equal
+	return compareUint(uint64(len(v.PreRelease)), uint64(len(o.PreRelease)))
+}
+
+// Compare parses the versions and returns -1, 0 or 1
+// if a is lower than, equal to or higher than b
+func Compare(a, b string) (int, error) {
+	av, err := ParseSemVer(a)
+	if err != nil {
+		return 0, err
+	}
+	bv, err := ParseSemVer(b)
+	if err != nil {
+		return 0, err
+	}
+	return av.Compare(bv), nil
+}
+
+// comparePreRelease compares the numeric identifiers numerically and the
+// rest in ASCII order, the numeric identifiers being the lower ones
+func comparePreRelease(a, b string) int {
+	aNum, bNum := isNumeric(a), isNumeric(b)
+	switch {
+	case aNum && bNum:
+		if c := compareUint(uint64(len(a)), uint64(len(b))); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
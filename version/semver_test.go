@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The OpenEBS Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package version
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSemVer(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       string
+		want    SemVer
+		wantErr bool
+	}{
+		{name: "Release", v: "2.12.2", want: SemVer{Major: 2, Minor: 12, Patch: 2}},
+		{name: "Leading v", v: "v3.0.0", want: SemVer{Major: 3}},
+		{name: "Without patch", v: "2.10", want: SemVer{Major: 2, Minor: 10}},
+		{name: "Release candidate", v: "2.11.0-RC1", want: SemVer{Major: 2, Minor: 11, PreRelease: []string{"RC1"}}},
+		{name: "Dotted pre-release", v: "3.0.0-alpha.1", want: SemVer{Major: 3, PreRelease: []string{"alpha", "1"}}},
+		{name: "Build metadata", v: "3.0.0+abc1234", want: SemVer{Major: 3}},
+		{name: "Only major", v: "2", wantErr: true},
+		{name: "Too many parts", v: "2.12.2.1", wantErr: true},
+		{name: "Empty part", v: "2..1", wantErr: true},
+		{name: "Not a number", v: "3.0.x", wantErr: true},
+		{name: "Negative", v: "2.-1.0", wantErr: true},
+		{name: "Leading zero", v: "2.09.0", wantErr: true},
+		{name: "Empty pre-release", v: "2.12.0-", wantErr: true},
+		{name: "Empty pre-release identifier", v: "2.12.0-RC1..1", wantErr: true},
+		{name: "Leading zero in pre-release", v: "2.12.0-01", wantErr: true},
+		{name: "Branch", v: "develop", wantErr: true},
+		{name: "Empty", v: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSemVer(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSemVer(%q) error = %v, wantErr %v", tt.v, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSemVer(%q) = %+v, want %+v", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "2.12.2", b: "2.12.2", want: 0},
+		{a: "2.10", b: "2.10.0", want: 0},
+		{a: "2.10", b: "2.9.1", want: 1},
+		{a: "2.9.1", b: "2.10.0", want: -1},
+		{a: "3.0.0", b: "2.12.2", want: 1},
+		{a: "2.12.10", b: "2.12.9", want: 1},
+		{a: "2.11.0-RC1", b: "2.11.0", want: -1},
+		{a: "2.11.0-RC1", b: "2.11.0-RC2", want: -1},
+		{a: "2.11.0-RC2", b: "2.10.0", want: 1},
+		{a: "3.0.0-alpha", b: "3.0.0-alpha.1", want: -1},
+		{a: "3.0.0-alpha.1", b: "3.0.0-alpha.beta", want: -1},
+		{a: "3.0.0-beta.2", b: "3.0.0-beta.11", want: -1},
+		{a: "3.0.0-rc.1", b: "3.0.0-beta.11", want: 1},
+		{a: "3.0.0+abc", b: "3.0.0+def", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			got, err := Compare(tt.a, tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+	if _, err := Compare("2.12.2", "2.12.x"); err == nil {
+		t.Errorf("Compare() of an invalid version should fail")
+	}
+}
@@ -14,54 +14,73 @@ limitations under the License.
 */
 package version
 
-import (
-	"strconv"
-	"strings"
-)
+import "strings"
 
 var (
-	minCurrentVersion   = "2.6.0"
-	validDesiredVersion = strings.Split(Version, "-")[0]
+	minCurrentVersion = "2.6.0"
+	// validDesiredVersion keeps the pre-release of the version, so
+	// that a volume is not downgraded from a later release candidate
+	validDesiredVersion = Version
 	// these are the versions used in various pipelines for ci testing
 	exceptions = []string{"master", "develop"}
 )
 
 // IsCurrentVersionValid verifies if the  current version is valid or not
 func IsCurrentVersionValid(v string) bool {
-	currentVersion := strings.Split(v, "-")[0]
-	return CanCurrentVersionBeUpgraded(currentVersion)
+	return CanCurrentVersionBeUpgraded(v)
 }
 
-// IsDesiredVersionValid verifies the desired version is valid or not
+// IsDesiredVersionValid verifies the desired version is a release of the
+// version of the operator which is not later than its own, so that the
+// desired 3.0.0-RC2 is rejected by an operator of 3.0.0-RC1
 func IsDesiredVersionValid(v string) bool {
-	desiredVersion := strings.Split(v, "-")[0]
-	return validDesiredVersion == desiredVersion
+	if isException(v) || isException(validDesiredVersion) {
+		return strings.Split(validDesiredVersion, "-")[0] == strings.Split(v, "-")[0]
+	}
+	desired, err := ParseSemVer(v)
+	if err != nil {
+		return false
+	}
+	valid, err := ParseSemVer(validDesiredVersion)
+	if err != nil {
+		return false
+	}
+	return desired.Major == valid.Major && desired.Minor == valid.Minor &&
+		desired.Patch == valid.Patch && desired.Compare(valid) <= 0
 }
 
 // CanCurrentVersionBeUpgraded determines whether the current version
 // is within the range of minCurrentVersion and validDesiredVersion
 func CanCurrentVersionBeUpgraded(version string) bool {
-	return IsOldLessThanOrEqualNewVersion(minCurrentVersion, version) &&
-		IsOldLessThanOrEqualNewVersion(version, validDesiredVersion)
+	aboveMin, err := IsOldLessThanOrEqualNewVersion(minCurrentVersion, version)
+	if err != nil || !aboveMin {
+		return false
+	}
+	belowDesired, err := IsOldLessThanOrEqualNewVersion(version, validDesiredVersion)
+	return err == nil && belowDesired
 }
 
 // IsOldLessThanOrEqualNewVersion compares old and new version and returns true
-// if old version is less `<` or equal then new version
-func IsOldLessThanOrEqualNewVersion(old, new string) bool {
-	oldVersions := strings.Split(strings.Split(old, "-")[0], ".")
-	newVersions := strings.Split(strings.Split(new, "-")[0], ".")
+// if old version is less `<` or equal then new version. The versions used in
+// the ci pipelines can be upgraded from and to any version. An error is
+// returned if either of the versions is not a semantic version.
+func IsOldLessThanOrEqualNewVersion(old, new string) (bool, error) {
+	if isException(old) || isException(new) {
+		return true, nil
+	}
+	c, err := Compare(old, new)
+	if err != nil {
+		return false, err
+	}
+	return c <= 0, nil
+}
+
+func isException(v string) bool {
+	v = strings.Split(v, "-")[0]
 	for _, exception := range exceptions {
-		if newVersions[0] == exception {
+		if v == exception {
 			return true
 		}
 	}
-	for i := 0; i < len(oldVersions); i++ {
-		oldVersion, _ := strconv.Atoi(oldVersions[i])
-		newVersion, _ := strconv.Atoi(newVersions[i])
-		if oldVersion == newVersion {
-			continue
-		}
-		return oldVersion < newVersion
-	}
-	return true
+	return false
 }
@@ -16,9 +16,16 @@ package version
 
 import "testing"
 
+// setValidDesiredVersion sets the version of the operator
+// for the test, and restores it once the test is done
+func setValidDesiredVersion(t *testing.T, v string) {
+	prev := validDesiredVersion
+	t.Cleanup(func() { validDesiredVersion = prev })
+	validDesiredVersion = v
+}
+
 func TestIsCurrentVersionValid(t *testing.T) {
-	// setting the variable for test
-	validDesiredVersion = "2.9.0"
+	setValidDesiredVersion(t, "2.9.0")
 	type args struct {
 		v string
 	}
@@ -57,3 +64,97 @@ func TestIsCurrentVersionValid(t *testing.T) {
 		})
 	}
 }
+
+func TestCanCurrentVersionBeUpgraded(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		desired string
+		want    bool
+	}{
+		{name: "Min version", current: "2.6.0", desired: "3.0.0", want: true},
+		{name: "Below min version", current: "2.5.0", desired: "3.0.0", want: false},
+		{name: "Release candidate of min version", current: "2.6.0-RC1", desired: "3.0.0", want: false},
+		{name: "Double digit minor version", current: "2.10.0", desired: "2.12.0", want: true},
+		{name: "Double digit minor desired version", current: "2.9.1", desired: "2.10.0", want: true},
+		{name: "Without patch version", current: "2.10", desired: "2.12.2", want: true},
+		{name: "Same version", current: "3.0.0", desired: "3.0.0", want: true},
+		{name: "Release candidate to release", current: "3.0.0-RC1", desired: "3.0.0", want: true},
+		{name: "Release candidate to later release candidate", current: "3.0.0-RC1", desired: "3.0.0-RC2", want: true},
+		{name: "Release candidate to earlier release candidate", current: "3.0.0-RC2", desired: "3.0.0-RC1", want: false},
+		{name: "Release to release candidate", current: "3.0.0", desired: "3.0.0-RC1", want: false},
+		{name: "Newer than desired version", current: "3.1.0", desired: "3.0.0", want: false},
+		{name: "Invalid current version", current: "2.x.0", desired: "3.0.0", want: false},
+		{name: "Invalid desired version", current: "2.12.0", desired: "3.0.x", want: false},
+		{name: "Empty current version", current: "", desired: "3.0.0", want: false},
+		{name: "Ci desired version", current: "2.12.2", desired: "develop", want: true},
+		{name: "Ci current version", current: "master", desired: "3.0.0", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setValidDesiredVersion(t, tt.desired)
+			if got := CanCurrentVersionBeUpgraded(tt.current); got != tt.want {
+				t.Errorf("CanCurrentVersionBeUpgraded(%q) to %q = %v, want %v",
+					tt.current, tt.desired, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDesiredVersionValid(t *testing.T) {
+	tests := []struct {
+		name     string
+		desired  string
+		operator string
+		want     bool
+	}{
+		{name: "Operator version", desired: "3.0.0", operator: "3.0.0", want: true},
+		{name: "Release candidate of operator version", desired: "3.0.0-RC1", operator: "3.0.0", want: true},
+		{name: "Same release candidate", desired: "3.0.0-RC1", operator: "3.0.0-RC1", want: true},
+		{name: "Later release candidate", desired: "3.0.0-RC2", operator: "3.0.0-RC1", want: false},
+		{name: "Release of operator release candidate", desired: "3.0.0", operator: "3.0.0-RC1", want: false},
+		{name: "Older version", desired: "2.12.2", operator: "3.0.0", want: false},
+		{name: "Newer version", desired: "3.1.0", operator: "3.0.0", want: false},
+		{name: "Invalid version", desired: "3.0.x", operator: "3.0.0", want: false},
+		{name: "Ci version", desired: "develop", operator: "develop", want: true},
+		{name: "Ci operator version", desired: "3.0.0", operator: "master", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setValidDesiredVersion(t, tt.operator)
+			if got := IsDesiredVersionValid(tt.desired); got != tt.want {
+				t.Errorf("IsDesiredVersionValid(%q) of operator %q = %v, want %v",
+					tt.desired, tt.operator, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsOldLessThanOrEqualNewVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		want    bool
+		wantErr bool
+	}{
+		{name: "Lower version", old: "2.9.1", new: "2.10", want: true},
+		{name: "Higher version", old: "2.10", new: "2.9.1", want: false},
+		{name: "Missing parts", old: "2.12", new: "2.12.0", want: true},
+		{name: "Pre-release", old: "2.11.0", new: "2.11.0-RC1", want: false},
+		{name: "Exception", old: "3.0.0", new: "master-dev", want: true},
+		{name: "Invalid old version", old: "2.12.0.1", new: "3.0.0", wantErr: true},
+		{name: "Invalid new version", old: "2.12.0", new: "3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsOldLessThanOrEqualNewVersion(tt.old, tt.new)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IsOldLessThanOrEqualNewVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("IsOldLessThanOrEqualNewVersion(%q, %q) = %v, want %v", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}